@@ -0,0 +1,392 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"io"
+	"math"
+	"time"
+)
+
+// defaultAPBFRate is the false-positive rate used when an invalid one is given
+// to an Age-Partitioned Bloom Filter constructor.
+const defaultAPBFRate = 0.01
+
+// AgePartitionedBloomFilter implements an Age-Partitioned Bloom Filter as
+// described by Shtul, Baquero, and Almeida in Age-Partitioned Bloom Filters:
+//
+// https://arxiv.org/abs/2001.03147
+//
+// The filter is a ring of k+l slices. Each element is added to the k newest
+// slices, using a different hash function for each slice. After every
+// generation, the oldest slice is cleared and becomes the newest, shifting the
+// others toward the end of the ring. An element is a member if it's found in k
+// consecutive slices, which holds until the slices it was added to are
+// cleared. This means there are no false negatives for elements added within
+// the last l generations.
+//
+// Generations advance either after a fixed number of insertions, which
+// deduplicates the last n elements of a stream, or after a fixed interval of
+// time, which deduplicates the elements seen within a time window. Unlike the
+// Stable Bloom Filter, which evicts cells randomly on every insertion, this
+// gives a precise window with no false negatives while keeping a bounded
+// false-positive rate.
+type AgePartitionedBloomFilter struct {
+	slices     []*Buckets       // ring of k+l slices
+	hash       hash.Hash64      // hash function (kernel for all k+l functions)
+	k          uint             // number of slices each element is added to
+	l          uint             // number of generations in the window
+	s          uint             // slice size
+	g          uint             // insertions per generation
+	base       uint             // index of the newest slice
+	count      uint             // insertions in the current generation
+	interval   time.Duration    // generation length, zero if count-based
+	generation time.Time        // start of the current generation
+	clock      func() time.Time // current time
+}
+
+// NewAgePartitionedBloomFilter creates a new Age-Partitioned Bloom Filter
+// which has no false negatives for the last n elements added and the
+// specified target false-positive rate. The rate must be between 0 and 1,
+// exclusive, otherwise the default of 0.01 is used.
+func NewAgePartitionedBloomFilter(n uint, fpRate float64) *AgePartitionedBloomFilter {
+	k := apbfOptimalK(fpRate)
+	return newAgePartitionedBloomFilter(k, k, n, 0)
+}
+
+// NewTimedAgePartitionedBloomFilter creates a new Age-Partitioned Bloom Filter
+// which has no false negatives for elements added within the given time
+// window and the specified target false-positive rate, assuming no more than
+// n elements are added per window. The rate must be between 0 and 1,
+// exclusive, otherwise the default of 0.01 is used.
+func NewTimedAgePartitionedBloomFilter(window time.Duration, n uint, fpRate float64) *AgePartitionedBloomFilter {
+	k := apbfOptimalK(fpRate)
+	interval := (window + time.Duration(k) - 1) / time.Duration(k)
+	return newAgePartitionedBloomFilter(k, k, n, interval)
+}
+
+// newAgePartitionedBloomFilter creates a new Age-Partitioned Bloom Filter with
+// k+l slices sized so that a generation of n/l insertions keeps the slices at
+// most half full. If interval is non-zero, generations advance on time rather
+// than on insertions.
+func newAgePartitionedBloomFilter(k, l, n uint, interval time.Duration) *AgePartitionedBloomFilter {
+	var (
+		g      = uint(math.Ceil(float64(n) / float64(l)))
+		s      = uint(math.Ceil(float64(k*g) / math.Ln2))
+		slices = make([]*Buckets, k+l)
+	)
+
+	if g == 0 {
+		g = 1
+	}
+	if s == 0 {
+		s = 1
+	}
+	for i := range slices {
+		slices[i] = NewBuckets(s, 1)
+	}
+
+	return &AgePartitionedBloomFilter{
+		slices:     slices,
+		hash:       fnv.New64(),
+		k:          k,
+		l:          l,
+		s:          s,
+		g:          g,
+		interval:   interval,
+		generation: time.Now(),
+		clock:      time.Now,
+	}
+}
+
+// apbfOptimalK returns the number of slices each element is added to for the
+// given false-positive rate, assuming the window has as many generations. With
+// slices at most half full, the false-positive rate is bounded by (l+1)/2^k.
+func apbfOptimalK(fpRate float64) uint {
+	if !(fpRate > 0 && fpRate < 1) {
+		fpRate = defaultAPBFRate
+	}
+
+	k := uint(1)
+	for float64(k+1)/math.Exp2(float64(k)) > fpRate {
+		k++
+	}
+	return k
+}
+
+// K returns the number of slices each element is added to.
+func (a *AgePartitionedBloomFilter) K() uint {
+	return a.k
+}
+
+// L returns the number of generations in the window.
+func (a *AgePartitionedBloomFilter) L() uint {
+	return a.l
+}
+
+// Capacity returns the number of elements which are guaranteed to be a member
+// after being added for a count-based filter, or the number of elements which
+// can be added per window without exceeding the false-positive rate for a
+// timed filter.
+func (a *AgePartitionedBloomFilter) Capacity() uint {
+	return a.l * a.g
+}
+
+// Interval returns the length of a generation, or zero if generations advance
+// on insertions.
+func (a *AgePartitionedBloomFilter) Interval() time.Duration {
+	return a.interval
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives. There are no false negatives for
+// elements added within the window. For timed filters, any generations which
+// have elapsed are advanced first.
+func (a *AgePartitionedBloomFilter) Test(data []byte) bool {
+	a.advance()
+	lower, upper := hashKernel(data, a.hash)
+
+	// Look for k consecutive slices containing the data.
+	run := uint(0)
+	for i := uint(0); i < a.k+a.l; i++ {
+		if !a.testSlice(a.slice(i), lower, upper) {
+			run = 0
+			continue
+		}
+		run++
+		if run == a.k {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Add will add the data to the filter. It returns the filter to allow for
+// chaining.
+func (a *AgePartitionedBloomFilter) Add(data []byte) Filter {
+	a.advance()
+	lower, upper := hashKernel(data, a.hash)
+
+	// Set the bit in each of the k newest slices.
+	for i := uint(0); i < a.k; i++ {
+		idx := a.slice(i)
+		a.slices[idx].Set((uint(lower)+uint(upper)*idx)%a.s, 1)
+	}
+
+	a.count++
+	return a
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not.
+func (a *AgePartitionedBloomFilter) TestAndAdd(data []byte) bool {
+	member := a.Test(data)
+	a.Add(data)
+	return member
+}
+
+// Reset restores the filter to its original state. It returns the filter to
+// allow for chaining.
+func (a *AgePartitionedBloomFilter) Reset() *AgePartitionedBloomFilter {
+	for _, slice := range a.slices {
+		slice.Reset()
+	}
+	a.base = 0
+	a.count = 0
+	a.generation = a.clock()
+	return a
+}
+
+// SetHash sets the hashing function used in the filter.
+// For the effect on false positive rates see: https://github.com/tylertreat/BoomFilters/pull/1
+func (a *AgePartitionedBloomFilter) SetHash(h hash.Hash64) {
+	a.hash = h
+}
+
+// SetClock sets the function used to get the current time for timed filters,
+// which defaults to time.Now. The current generation starts at the clock's
+// current time, so it should be set before any data is added.
+func (a *AgePartitionedBloomFilter) SetClock(clock func() time.Time) {
+	a.clock = clock
+	a.generation = clock()
+}
+
+// slice returns the index of the ith newest slice.
+func (a *AgePartitionedBloomFilter) slice(i uint) uint {
+	return (a.base + i) % (a.k + a.l)
+}
+
+// testSlice indicates if the bit for the hash is set in the slice.
+func (a *AgePartitionedBloomFilter) testSlice(idx uint, lower, upper uint32) bool {
+	return a.slices[idx].Get((uint(lower)+uint(upper)*idx)%a.s) == 1
+}
+
+// advance starts a new generation for each interval which has elapsed for a
+// timed filter, or if the current generation is full for a count-based
+// filter.
+func (a *AgePartitionedBloomFilter) advance() {
+	if a.interval == 0 {
+		if a.count >= a.g {
+			a.shift()
+		}
+		return
+	}
+
+	elapsed := a.clock().Sub(a.generation)
+	if elapsed < a.interval {
+		return
+	}
+
+	generations := elapsed / a.interval
+	a.generation = a.generation.Add(generations * a.interval)
+	if generations > time.Duration(a.k+a.l) {
+		generations = time.Duration(a.k + a.l)
+	}
+	for i := time.Duration(0); i < generations; i++ {
+		a.shift()
+	}
+}
+
+// shift clears the oldest slice and makes it the newest.
+func (a *AgePartitionedBloomFilter) shift() {
+	a.base = (a.base + a.k + a.l - 1) % (a.k + a.l)
+	a.slices[a.base].Reset()
+	a.count = 0
+}
+
+// WriteTo writes a binary representation of the AgePartitionedBloomFilter to
+// an i/o stream. It returns the number of bytes written.
+func (a *AgePartitionedBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, uint64(a.k))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(a.l))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(a.s))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(a.g))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(a.base))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(a.count))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, int64(a.interval))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, a.generation.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	numBytes := int64(8 * binary.Size(uint64(0)))
+	for _, slice := range a.slices {
+		num, err := slice.WriteTo(stream)
+		if err != nil {
+			return 0, err
+		}
+		numBytes += num
+	}
+	return numBytes, nil
+}
+
+// ReadFrom reads a binary representation of AgePartitionedBloomFilter (such as
+// might have been written by WriteTo()) from an i/o stream. It returns the
+// number of bytes read.
+func (a *AgePartitionedBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	var k, l, s, g, base, count uint64
+	var interval, generation int64
+	err := binary.Read(stream, binary.BigEndian, &k)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &l)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &s)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &g)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &base)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &count)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &interval)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &generation)
+	if err != nil {
+		return 0, err
+	}
+	numBytes := int64(8 * binary.Size(uint64(0)))
+	slices := make([]*Buckets, k+l)
+	for i := range slices {
+		buckets := &Buckets{}
+		num, err := buckets.ReadFrom(stream)
+		if err != nil {
+			return 0, err
+		}
+		numBytes += num
+		slices[i] = buckets
+	}
+
+	a.k = uint(k)
+	a.l = uint(l)
+	a.s = uint(s)
+	a.g = uint(g)
+	a.base = uint(base)
+	a.count = uint(count)
+	a.interval = time.Duration(interval)
+	a.generation = time.Unix(0, generation)
+	a.slices = slices
+	if a.hash == nil {
+		a.hash = fnv.New64()
+	}
+	if a.clock == nil {
+		a.clock = time.Now
+	}
+	return numBytes, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (a *AgePartitionedBloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := a.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (a *AgePartitionedBloomFilter) GobDecode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := a.ReadFrom(buf)
+
+	return err
+}
@@ -0,0 +1,239 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Ensures that K and L return the number of slices and generations for the
+// false-positive rate and Capacity returns the window size.
+func TestAgePartitionedBloomParameters(t *testing.T) {
+	f := NewAgePartitionedBloomFilter(1000, 0.01)
+
+	if k := f.K(); k != 11 {
+		t.Errorf("Expected 11, got %d", k)
+	}
+
+	if l := f.L(); l != 11 {
+		t.Errorf("Expected 11, got %d", l)
+	}
+
+	if capacity := f.Capacity(); capacity != 1001 {
+		t.Errorf("Expected 1001, got %d", capacity)
+	}
+
+	if interval := f.Interval(); interval != 0 {
+		t.Errorf("Expected 0, got %s", interval)
+	}
+}
+
+// Ensures that false-positive rates which aren't between 0 and 1 are replaced
+// by the default.
+func TestAgePartitionedBloomInvalidRate(t *testing.T) {
+	for _, fpRate := range []float64{0, -0.01, 1, 2, math.NaN()} {
+		if k := NewAgePartitionedBloomFilter(1000, fpRate).K(); k != 11 {
+			t.Errorf("Expected 11 for %f, got %d", fpRate, k)
+		}
+
+		if k := NewTimedAgePartitionedBloomFilter(time.Minute, 1000, fpRate).K(); k != 11 {
+			t.Errorf("Expected 11 for %f, got %d", fpRate, k)
+		}
+	}
+}
+
+// Ensures that there are no false negatives for the last n elements added and
+// older elements are eventually evicted.
+func TestAgePartitionedBloomWindow(t *testing.T) {
+	var (
+		n = uint(1000)
+		f = NewAgePartitionedBloomFilter(n, 0.01)
+	)
+
+	for i := 0; i < 5000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	for i := 5000 - int(n); i < 5000; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+
+	evicted, unseen := 0, 0
+	for i := 0; i < 1000; i++ {
+		if f.Test([]byte(strconv.Itoa(i))) {
+			evicted++
+		}
+		if f.Test([]byte(strconv.Itoa(i + 10000))) {
+			unseen++
+		}
+	}
+
+	if evicted > 20 {
+		t.Errorf("Expected at most 20 false positives for evicted elements, got %d", evicted)
+	}
+
+	if unseen > 20 {
+		t.Errorf("Expected at most 20 false positives for unseen elements, got %d", unseen)
+	}
+}
+
+// Ensures that a timed filter has no false negatives within the window and
+// evicts elements once the window has passed.
+func TestAgePartitionedBloomTimed(t *testing.T) {
+	clock := newTestClock()
+	f := NewTimedAgePartitionedBloomFilter(time.Minute, 100, 0.01)
+	f.SetClock(clock.Now)
+
+	if window := f.Interval() * time.Duration(f.L()); window < time.Minute {
+		t.Errorf("Expected window of at least 1m0s, got %s", window)
+	}
+
+	f.Add([]byte(`a`))
+	clock.Advance(30 * time.Second)
+	f.Add([]byte(`b`))
+	clock.Advance(29 * time.Second)
+
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if !f.Test([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+
+	clock.Advance(2 * time.Minute)
+
+	if f.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+
+	if f.Test([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+
+	// Elements added after a long pause are still members.
+	clock.Advance(24 * time.Hour)
+	f.Add([]byte(`c`))
+	if !f.Test([]byte(`c`)) {
+		t.Error("`c` should be a member")
+	}
+}
+
+// Ensures that TestAndAdd behaves correctly.
+func TestAgePartitionedBloomTestAndAdd(t *testing.T) {
+	f := NewAgePartitionedBloomFilter(100, 0.01)
+
+	if f.TestAndAdd([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if !f.TestAndAdd([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+}
+
+// Ensures that Reset clears all slices.
+func TestAgePartitionedBloomReset(t *testing.T) {
+	f := NewAgePartitionedBloomFilter(100, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if f.Reset() != f {
+		t.Error("Returned AgePartitionedBloomFilter should be the same instance")
+	}
+
+	for i, slice := range f.slices {
+		for j := uint(0); j < slice.Count(); j++ {
+			if slice.Get(j) != 0 {
+				t.Fatalf("Expected all bits in slice %d to be unset", i)
+			}
+		}
+	}
+}
+
+// Ensures that the filter can be serialized mid-generation and resumed.
+func TestAgePartitionedBloomSerialization(t *testing.T) {
+	f := NewAgePartitionedBloomFilter(100, 0.01)
+	for i := 0; i < 250; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(f); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &AgePartitionedBloomFilter{}
+	if err := gob.NewDecoder(&buf).Decode(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	wn, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := NewAgePartitionedBloomFilter(1, 0.1)
+	rn, err := read.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wn != rn {
+		t.Errorf("Expected %d bytes read, got %d", wn, rn)
+	}
+
+	for i := 250; i < 300; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+		decoded.Add([]byte(strconv.Itoa(i)))
+		read.Add([]byte(strconv.Itoa(i)))
+	}
+
+	for i := 0; i < 400; i++ {
+		expected := f.Test([]byte(strconv.Itoa(i)))
+		if actual := decoded.Test([]byte(strconv.Itoa(i))); actual != expected {
+			t.Errorf("Expected %t for %d, got %t", expected, i, actual)
+		}
+		if actual := read.Test([]byte(strconv.Itoa(i))); actual != expected {
+			t.Errorf("Expected %t for %d, got %t", expected, i, actual)
+		}
+	}
+}
+
+func BenchmarkAgePartitionedBloomAdd(b *testing.B) {
+	b.StopTimer()
+	f := NewAgePartitionedBloomFilter(100000, 0.01)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
+
+func BenchmarkAgePartitionedBloomTest(b *testing.B) {
+	b.StopTimer()
+	f := NewAgePartitionedBloomFilter(100000, 0.01)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Test(data[n])
+	}
+}
@@ -1,9 +1,10 @@
 /*
 Package boom implements probabilistic data structures for processing
 continuous, unbounded data streams. This includes Stable Bloom Filters,
-Scalable Bloom Filters, Counting Bloom Filters, Inverse Bloom Filters, several
-variants of traditional Bloom filters, HyperLogLog, Count-Min Sketch, and
-MinHash.
+Age-Partitioned Bloom Filters, Rotating Bloom Filters, Scalable Bloom
+Filters, Counting Bloom Filters, Inverse Bloom Filters, several variants of
+traditional Bloom filters, HyperLogLog, Theta Sketch, Count-Min Sketch,
+t-digest, KLL Sketch, DDSketch, and MinHash.
 
 Classic Bloom filters generally require a priori knowledge of the data set
 in order to allocate an appropriately sized bit array. This works well for
@@ -13,22 +14,33 @@ which it has a false-positive probability of 1.
 
 Boom Filters are useful for situations where the size of the data set isn't
 known ahead of time. For example, a Stable Bloom Filter can be used to
-deduplicate events from an unbounded event stream with a specified upper
-bound on false positives and minimal false negatives. Alternatively, an
-Inverse Bloom Filter is ideal for deduplicating a stream where duplicate
-events are relatively close together. This results in no false positives
-and, depending on how close together duplicates are, a small probability of
-false negatives. Scalable Bloom Filters place a tight upper bound on false
-positives while avoiding false negatives but require allocating memory
-proportional to the size of the data set. Counting Bloom Filters and Cuckoo
-Filters are useful for cases which require adding and removing elements to and
-from a set.
+deduplicate events from an unbounded event stream with a specified upper bound
+on false positives and minimal false negatives. An Age-Partitioned Bloom Filter
+deduplicates the elements seen within a sliding window, such as the last n
+elements or the last 10 minutes, with no false negatives, while a Rotating
+Bloom Filter provides a simpler time-to-live using generations of classic Bloom
+filters. Alternatively, an Inverse Bloom Filter is ideal for deduplicating a
+stream where duplicate events are relatively close together. This results in no
+false positives and, depending on how close together duplicates are, a small
+probability of false negatives. Scalable Bloom Filters place a tight upper
+bound on false positives while avoiding false negatives but require allocating
+memory proportional to the size of the data set. Counting Bloom Filters and
+Cuckoo Filters are useful for cases which require adding and removing elements
+to and from a set, and Scalable Cuckoo Filters do so without knowing the size
+of the set ahead of time. Counting Cuckoo Filters estimate how many times each
+element of a multiset was added, Cuckoo Maps store a small value for each key,
+and TTL Cuckoo Filters expire elements after a time-to-live.
 
 For large or unbounded data sets, calculating the exact cardinality is
 impractical. HyperLogLog uses a fraction of the memory while providing an
-accurate approximation. Similarly, Count-Min Sketch provides an efficient way
-to estimate event frequency for data streams. TopK tracks the top-k most
-frequent elements.
+accurate approximation. Theta Sketch additionally supports union,
+intersection, and difference of sets. Similarly, Count-Min Sketch provides an
+efficient way to estimate event frequency for data streams. TopK, SpaceSaving,
+and HeavyKeeper track the top-k most frequent elements, while DecayingTopK
+tracks the top-k trending elements. For quantiles such as latency percentiles,
+t-digest summarizes the distribution of a stream in bounded memory, while KLL
+Sketch guarantees a bound on the rank error and DDSketch guarantees a bound on
+the relative error.
 
 MinHash is a probabilistic algorithm to approximate the similarity between two
 sets. This can be used to cluster or compare documents by splitting the corpus
@@ -72,6 +84,44 @@ func OptimalK(fpRate float64) uint {
 	return uint(math.Ceil(math.Log2(1 / fpRate)))
 }
 
+// bloomCardinality estimates the number of elements added to a Bloom filter
+// of m bits using k hash functions from the number of set bits, x, as
+// described by Swamidass and Baldi in Mathematical correction for fingerprint
+// similarity measures to improve chemical retrieval. A full filter is treated
+// as having a single bit unset.
+func bloomCardinality(x, m, k uint) float64 {
+	if x >= m {
+		x = m - 1
+	}
+	return -float64(m) / float64(k) * math.Log(1-float64(x)/float64(m))
+}
+
+// hashProbe is hashed to check whether two filters use the same hash
+// function.
+var hashProbe = []byte("boom")
+
+// sameHash indicates if the hash functions produce the same hash values, in
+// which case filters using them can be combined.
+func sameHash(h1, h2 hash.Hash64) bool {
+	lower1, upper1 := hashKernel(hashProbe, h1)
+	lower2, upper2 := hashKernel(hashProbe, h2)
+	return lower1 == lower2 && upper1 == upper2
+}
+
+// sameHash32 indicates if the 32-bit hash functions produce the same hash
+// values, in which case filters using them can be combined.
+func sameHash32(h1, h2 hash.Hash32) bool {
+	return hashSum32(hashProbe, h1) == hashSum32(hashProbe, h2)
+}
+
+// hashSum32 returns the 32-bit hash value for the given data.
+func hashSum32(data []byte, hash hash.Hash32) uint32 {
+	hash.Write(data)
+	sum := hash.Sum32()
+	hash.Reset()
+	return sum
+}
+
 // hashKernel returns the upper and lower base hash values from which the k
 // hashes are derived.
 func hashKernel(data []byte, hash hash.Hash64) (uint32, uint32) {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
+	"math/bits"
 )
 
 // Buckets is a fast, space-efficient array of buckets where each bucket can
@@ -48,7 +49,7 @@ func (b *Buckets) Increment(bucket uint, delta int32) *Buckets {
 		val = 0
 	}
 
-	b.setBits(uint32(bucket)*uint32(b.bucketSize), uint32(b.bucketSize), uint32(val))
+	b.setBits(bucket*uint(b.bucketSize), uint(b.bucketSize), uint32(val))
 	return b
 }
 
@@ -59,7 +60,7 @@ func (b *Buckets) Set(bucket uint, value uint8) *Buckets {
 		value = b.max
 	}
 
-	b.setBits(uint32(bucket)*uint32(b.bucketSize), uint32(b.bucketSize), uint32(value))
+	b.setBits(bucket*uint(b.bucketSize), uint(b.bucketSize), uint32(value))
 	return b
 }
 
@@ -75,6 +76,38 @@ func (b *Buckets) Reset() *Buckets {
 	return b
 }
 
+// clone returns a copy of the Buckets.
+func (b *Buckets) clone() *Buckets {
+	clone := *b
+	clone.data = append([]byte(nil), b.data...)
+	return &clone
+}
+
+// or sets each bit which is set in the other Buckets, which must have the same
+// number and size of buckets.
+func (b *Buckets) or(other *Buckets) {
+	for i := range b.data {
+		b.data[i] |= other.data[i]
+	}
+}
+
+// and clears each bit which isn't set in the other Buckets, which must have
+// the same number and size of buckets.
+func (b *Buckets) and(other *Buckets) {
+	for i := range b.data {
+		b.data[i] &= other.data[i]
+	}
+}
+
+// ones returns the number of set bits.
+func (b *Buckets) ones() uint {
+	count := 0
+	for _, octet := range b.data {
+		count += bits.OnesCount8(octet)
+	}
+	return uint(count)
+}
+
 // getBits returns the bits at the specified offset and length.
 func (b *Buckets) getBits(offset, length uint) uint32 {
 	byteIndex := offset / 8
@@ -88,7 +121,7 @@ func (b *Buckets) getBits(offset, length uint) uint32 {
 }
 
 // setBits sets bits at the specified offset and length.
-func (b *Buckets) setBits(offset, length, bits uint32) {
+func (b *Buckets) setBits(offset, length uint, bits uint32) {
 	byteIndex := offset / 8
 	byteOffset := offset % 8
 	if byteOffset+length > 8 {
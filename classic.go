@@ -3,6 +3,7 @@ package boom
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"hash"
 	"hash/fnv"
 	"io"
@@ -114,9 +115,127 @@ func (b *BloomFilter) TestAndAdd(data []byte) bool {
 // to allow for chaining.
 func (b *BloomFilter) Reset() *BloomFilter {
 	b.buckets.Reset()
+	b.count = 0
 	return b
 }
 
+// Union returns a new Bloom filter containing the elements of both filters,
+// leaving them unchanged. Returns an error if the filters don't have the same
+// size and number of hash functions, or don't use the same hash function.
+func (b *BloomFilter) Union(other *BloomFilter) (*BloomFilter, error) {
+	union := b.clone()
+	if err := union.UnionInPlace(other); err != nil {
+		return nil, err
+	}
+	return union, nil
+}
+
+// UnionInPlace adds the elements of another Bloom filter to this one by
+// setting each bit set in either filter. The count becomes the estimated
+// cardinality of the union. Returns an error if the filters don't have the
+// same size and number of hash functions, or don't use the same hash
+// function.
+func (b *BloomFilter) UnionInPlace(other *BloomFilter) error {
+	if err := b.compatible(other); err != nil {
+		return err
+	}
+
+	b.buckets.or(other.buckets)
+	b.count = uint(b.cardinality() + 0.5)
+	return nil
+}
+
+// Intersect returns a new Bloom filter containing the elements common to both
+// filters, leaving them unchanged. Returns an error if the filters don't have
+// the same size and number of hash functions, or don't use the same hash
+// function.
+func (b *BloomFilter) Intersect(other *BloomFilter) (*BloomFilter, error) {
+	intersection := b.clone()
+	if err := intersection.IntersectInPlace(other); err != nil {
+		return nil, err
+	}
+	return intersection, nil
+}
+
+// IntersectInPlace keeps only the elements of this Bloom filter which are also
+// in another one by clearing each bit not set in both filters. The
+// intersection has a higher false-positive rate than a filter built from the
+// common elements, since bits set by different elements in each filter remain
+// set. The count becomes the estimated cardinality of the intersection.
+// Returns an error if the filters don't have the same size and number of hash
+// functions, or don't use the same hash function.
+func (b *BloomFilter) IntersectInPlace(other *BloomFilter) error {
+	count, err := b.IntersectionCount(other)
+	if err != nil {
+		return err
+	}
+
+	b.buckets.and(other.buckets)
+	b.count = uint(count)
+	return nil
+}
+
+// UnionCount returns the estimated number of distinct elements in either
+// filter, based on the number of bits set in either filter. Returns an error
+// if the filters don't have the same size and number of hash functions, or
+// don't use the same hash function.
+func (b *BloomFilter) UnionCount(other *BloomFilter) (uint64, error) {
+	union, err := b.Union(other)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(union.cardinality() + 0.5), nil
+}
+
+// IntersectionCount returns the estimated number of distinct elements in both
+// filters using the inclusion-exclusion principle, |A∩B| = |A| + |B| -
+// |A∪B|, with each cardinality estimated from the number of set bits. Returns
+// an error if the filters don't have the same size and number of hash
+// functions, or don't use the same hash function.
+func (b *BloomFilter) IntersectionCount(other *BloomFilter) (uint64, error) {
+	union, err := b.Union(other)
+	if err != nil {
+		return 0, err
+	}
+
+	count := b.cardinality() + other.cardinality() - union.cardinality()
+	if count < 0 {
+		return 0, nil
+	}
+	return uint64(count + 0.5), nil
+}
+
+// cardinality returns the estimated number of distinct elements in the filter
+// based on the number of set bits.
+func (b *BloomFilter) cardinality() float64 {
+	return bloomCardinality(b.buckets.ones(), b.m, b.k)
+}
+
+// clone returns a copy of the filter which uses the same hash function.
+func (b *BloomFilter) clone() *BloomFilter {
+	clone := *b
+	clone.buckets = b.buckets.clone()
+	return &clone
+}
+
+// compatible returns an error if the filters don't have the same size and
+// number of hash functions, or don't use the same hash function.
+func (b *BloomFilter) compatible(other *BloomFilter) error {
+	if b.m != other.m {
+		return errors.New("filter size must match")
+	}
+
+	if b.k != other.k {
+		return errors.New("number of hash functions must match")
+	}
+
+	if !sameHash(b.hash, other.hash) {
+		return errors.New("hash functions must match")
+	}
+
+	return nil
+}
+
 // SetHash sets the hashing function used in the filter.
 // For the effect on false positive rates see: https://github.com/tylertreat/BoomFilters/pull/1
 func (b *BloomFilter) SetHash(h hash.Hash64) {
@@ -3,6 +3,7 @@ package boom
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"hash"
 	"hash/fnv"
 	"io"
@@ -24,12 +25,20 @@ import (
 // Counting Bloom Filters are useful for cases where elements are both added
 // and removed from the data set. Since they use n-bit buckets, CBFs use
 // roughly n-times more memory than traditional Bloom filters.
+//
+// A bucket which reaches the maximum bucket value is saturated, since further
+// increments would be lost. Saturated buckets are sticky: they're never
+// decremented, so removing elements can't cause false negatives, at the cost
+// of never removing elements hashed to them. Like a Spectral Bloom Filter,
+// the filter also estimates how many times an element was added as the
+// minimum of its buckets.
 type CountingBloomFilter struct {
 	buckets     *Buckets    // filter data
 	hash        hash.Hash64 // hash function (kernel for all k functions)
 	m           uint        // number of buckets
 	k           uint        // number of hash functions
 	count       uint        // number of items in the filter
+	overflowed  uint        // number of saturated buckets
 	indexBuffer []uint      // buffer used to cache indices
 }
 
@@ -73,6 +82,27 @@ func (c *CountingBloomFilter) Count() uint {
 	return c.count
 }
 
+// Overflowed returns the number of buckets which have saturated. Elements
+// hashed to a saturated bucket can't be removed from it.
+func (c *CountingBloomFilter) Overflowed() uint {
+	return c.overflowed
+}
+
+// Frequency returns the approximate number of times the data was added, which
+// is the minimum of its buckets. Frequencies are never underestimated unless
+// the data was removed more times than it was added, and are capped at the
+// maximum bucket value.
+func (c *CountingBloomFilter) Frequency(data []byte) uint64 {
+	lower, upper := hashKernel(data, c.hash)
+	count := uint32(c.buckets.MaxBucketValue())
+	for i := uint(0); i < c.k; i++ {
+		if value := c.buckets.Get((uint(lower) + uint(upper)*i) % c.m); value < count {
+			count = value
+		}
+	}
+	return uint64(count)
+}
+
 // Test will test for membership of the data and returns true if it is a
 // member, false if not. This is a probabilistic test, meaning there is a
 // non-zero probability of false positives and false negatives.
@@ -96,7 +126,7 @@ func (c *CountingBloomFilter) Add(data []byte) Filter {
 
 	// Set the K bits.
 	for i := uint(0); i < c.k; i++ {
-		c.buckets.Increment((uint(lower)+uint(upper)*i)%c.m, 1)
+		c.increment((uint(lower) + uint(upper)*i) % c.m)
 	}
 
 	c.count++
@@ -115,7 +145,7 @@ func (c *CountingBloomFilter) TestAndAdd(data []byte) bool {
 		if c.buckets.Get(idx) == 0 {
 			member = false
 		}
-		c.buckets.Increment(idx, 1)
+		c.increment(idx)
 	}
 
 	c.count++
@@ -138,7 +168,7 @@ func (c *CountingBloomFilter) TestAndRemove(data []byte) bool {
 
 	if member {
 		for _, idx := range c.indexBuffer {
-			c.buckets.Increment(idx, -1)
+			c.decrement(idx)
 		}
 		c.count--
 	}
@@ -151,9 +181,144 @@ func (c *CountingBloomFilter) TestAndRemove(data []byte) bool {
 func (c *CountingBloomFilter) Reset() *CountingBloomFilter {
 	c.buckets.Reset()
 	c.count = 0
+	c.overflowed = 0
 	return c
 }
 
+// Merge adds the buckets of another Counting Bloom Filter to this one, as if
+// its elements were added to this filter. Buckets which overflow saturate.
+// Returns an error if the filters don't have the same number of buckets and
+// hash functions, or don't use the same hash function.
+func (c *CountingBloomFilter) Merge(other *CountingBloomFilter) error {
+	if err := c.compatible(other); err != nil {
+		return err
+	}
+
+	var (
+		max      = uint32(c.buckets.MaxBucketValue())
+		otherMax = uint32(other.buckets.MaxBucketValue())
+	)
+	for i := uint(0); i < c.m; i++ {
+		value, otherValue := c.buckets.Get(i), other.buckets.Get(i)
+		if value == max || otherValue == 0 {
+			continue
+		}
+		if otherValue == otherMax || value+otherValue >= max {
+			c.buckets.Set(i, uint8(max))
+			c.overflowed++
+			continue
+		}
+		c.buckets.Set(i, uint8(value+otherValue))
+	}
+
+	c.count += other.count
+	return nil
+}
+
+// Subtract removes the buckets of another Counting Bloom Filter from this one,
+// as if its elements were removed from this filter, leaving the elements
+// added to this filter but not the other. Buckets are clamped to zero, and
+// saturated buckets are left unchanged. Returns an error if the filters don't
+// have the same number of buckets and hash functions, or don't use the same
+// hash function.
+func (c *CountingBloomFilter) Subtract(other *CountingBloomFilter) error {
+	if err := c.compatible(other); err != nil {
+		return err
+	}
+
+	max := uint32(c.buckets.MaxBucketValue())
+	for i := uint(0); i < c.m; i++ {
+		value, otherValue := c.buckets.Get(i), other.buckets.Get(i)
+		if value == max || otherValue == 0 {
+			continue
+		}
+		if otherValue >= value {
+			c.buckets.Set(i, 0)
+			continue
+		}
+		c.buckets.Set(i, uint8(value-otherValue))
+	}
+
+	if other.count >= c.count {
+		c.count = 0
+	} else {
+		c.count -= other.count
+	}
+	return nil
+}
+
+// Flatten returns a classic Bloom filter with the same elements, which sets
+// each bit whose bucket is non-zero. It uses the same hash function, so it can
+// be tested for the same data.
+func (c *CountingBloomFilter) Flatten() *BloomFilter {
+	buckets := NewBuckets(c.m, 1)
+	for i := uint(0); i < c.m; i++ {
+		if c.buckets.Get(i) != 0 {
+			buckets.Set(i, 1)
+		}
+	}
+
+	return &BloomFilter{
+		buckets: buckets,
+		hash:    c.hash,
+		m:       c.m,
+		k:       c.k,
+		count:   c.count,
+	}
+}
+
+// compatible returns an error if the filters don't have the same number of
+// buckets and hash functions, or don't use the same hash function.
+func (c *CountingBloomFilter) compatible(other *CountingBloomFilter) error {
+	if c.m != other.m {
+		return errors.New("number of buckets must match")
+	}
+
+	if c.k != other.k {
+		return errors.New("number of hash functions must match")
+	}
+
+	if !sameHash(c.hash, other.hash) {
+		return errors.New("hash functions must match")
+	}
+
+	return nil
+}
+
+// increment increments the bucket unless it's saturated.
+func (c *CountingBloomFilter) increment(idx uint) {
+	max := uint32(c.buckets.MaxBucketValue())
+	value := c.buckets.Get(idx)
+	if value == max {
+		return
+	}
+	c.buckets.Increment(idx, 1)
+	if value+1 == max {
+		c.overflowed++
+	}
+}
+
+// decrement decrements the bucket unless it's saturated.
+func (c *CountingBloomFilter) decrement(idx uint) {
+	if c.buckets.Get(idx) != uint32(c.buckets.MaxBucketValue()) {
+		c.buckets.Increment(idx, -1)
+	}
+}
+
+// saturated returns the number of saturated buckets.
+func (c *CountingBloomFilter) saturated() uint {
+	var (
+		max   = uint32(c.buckets.MaxBucketValue())
+		count = uint(0)
+	)
+	for i := uint(0); i < c.buckets.Count(); i++ {
+		if c.buckets.Get(i) == max {
+			count++
+		}
+	}
+	return count
+}
+
 // SetHash sets the hashing function used in the filter.
 // For the effect on false positive rates see: https://github.com/tylertreat/BoomFilters/pull/1
 func (c *CountingBloomFilter) SetHash(h hash.Hash64) {
@@ -229,6 +394,7 @@ func (c *CountingBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
 		return 0, err
 	}
 	c.m, c.k, c.count, c.buckets = uint(m), uint(k), uint(count), &buckets
+	c.overflowed = c.saturated()
 	return readSize + int64((4+ibc)*uint64(binary.Size(uint64(0)))), nil
 }
 
@@ -3,6 +3,7 @@ package boom
 import (
 	"bytes"
 	"encoding/gob"
+	"hash/fnv"
 	"math/rand"
 	"strconv"
 	"testing"
@@ -183,6 +184,195 @@ func TestCountingReset(t *testing.T) {
 	}
 }
 
+// Ensures that Frequency estimates how many times the data was added.
+func TestCountingFrequency(t *testing.T) {
+	f := NewCountingBloomFilter(100, 8, 0.01)
+	for i := 0; i < 10; i++ {
+		for j := 0; j <= i; j++ {
+			f.Add([]byte(strconv.Itoa(i)))
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		if count := f.Frequency([]byte(strconv.Itoa(i))); count < uint64(i+1) {
+			t.Errorf("Expected at least %d, got %d", i+1, count)
+		}
+	}
+
+	if count := f.Frequency([]byte(`a`)); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+
+	f.TestAndRemove([]byte(`9`))
+	if count := f.Frequency([]byte(`9`)); count < 9 {
+		t.Errorf("Expected at least 9, got %d", count)
+	}
+}
+
+// Ensures that saturated buckets are counted and never decremented, so
+// removing elements doesn't cause false negatives.
+func TestCountingOverflow(t *testing.T) {
+	f := NewCountingBloomFilter(100, 2, 0.01)
+	for i := 0; i < 5; i++ {
+		f.Add([]byte(`a`))
+	}
+
+	if overflowed := f.Overflowed(); overflowed != f.K() {
+		t.Errorf("Expected %d, got %d", f.K(), overflowed)
+	}
+
+	if count := f.Frequency([]byte(`a`)); count != 3 {
+		t.Errorf("Expected 3, got %d", count)
+	}
+
+	for i := 0; i < 5; i++ {
+		if !f.TestAndRemove([]byte(`a`)) {
+			t.Error("`a` should be a member")
+		}
+	}
+
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member since its buckets are saturated")
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	read := &CountingBloomFilter{}
+	if _, err := read.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if overflowed := read.Overflowed(); overflowed != f.K() {
+		t.Errorf("Expected %d, got %d", f.K(), overflowed)
+	}
+
+	f.Reset()
+	if overflowed := f.Overflowed(); overflowed != 0 {
+		t.Errorf("Expected 0, got %d", overflowed)
+	}
+}
+
+// Ensures that Merge adds the buckets of another filter and rejects filters
+// with different parameters.
+func TestCountingMerge(t *testing.T) {
+	f1 := NewCountingBloomFilter(100, 4, 0.01)
+	f2 := NewCountingBloomFilter(100, 4, 0.01)
+	for i := 0; i < 50; i++ {
+		f1.Add([]byte(strconv.Itoa(i)))
+		f2.Add([]byte(strconv.Itoa(i + 50)))
+	}
+	f1.Add([]byte(`a`))
+	for i := 0; i < 20; i++ {
+		f2.Add([]byte(`a`))
+	}
+
+	if err := f1.Merge(f2); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := f1.Count(); count != 121 {
+		t.Errorf("Expected 121, got %d", count)
+	}
+
+	for i := 0; i < 100; i++ {
+		if !f1.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+
+	if count := f1.Frequency([]byte(`a`)); count != 15 {
+		t.Errorf("Expected 15, got %d", count)
+	}
+
+	if f1.Overflowed() < f1.K() {
+		t.Errorf("Expected at least %d, got %d", f1.K(), f1.Overflowed())
+	}
+
+	if err := f1.Merge(NewCountingBloomFilter(1000, 4, 0.01)); err == nil {
+		t.Error("Expected error for different number of buckets")
+	}
+
+	other := NewCountingBloomFilter(100, 4, 0.01)
+	other.SetHash(fnv.New64a())
+	if err := f1.Merge(other); err == nil {
+		t.Error("Expected error for different hash function")
+	}
+}
+
+// Ensures that Subtract leaves the elements added to the filter but not the
+// other.
+func TestCountingSubtract(t *testing.T) {
+	f1 := NewCountingBloomFilter(100, 4, 0.001)
+	f2 := NewCountingBloomFilter(100, 4, 0.001)
+	for i := 0; i < 100; i++ {
+		f1.Add([]byte(strconv.Itoa(i)))
+	}
+	for i := 50; i < 100; i++ {
+		f2.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if err := f1.Subtract(f2); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := f1.Count(); count != 50 {
+		t.Errorf("Expected 50, got %d", count)
+	}
+
+	for i := 0; i < 50; i++ {
+		if !f1.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+
+	members := 0
+	for i := 50; i < 100; i++ {
+		if f1.Test([]byte(strconv.Itoa(i))) {
+			members++
+		}
+	}
+	if members > 5 {
+		t.Errorf("Expected few of the subtracted elements to be members, got %d", members)
+	}
+
+	if err := f1.Subtract(f1); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := f1.Count(); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+
+	if err := f1.Subtract(NewCountingBloomFilter(100, 4, 0.1)); err == nil {
+		t.Error("Expected error for different parameters")
+	}
+}
+
+// Ensures that Flatten returns a Bloom filter with the same elements.
+func TestCountingFlatten(t *testing.T) {
+	f := NewDefaultCountingBloomFilter(100, 0.01)
+	for i := 0; i < 100; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	b := f.Flatten()
+
+	if b.Capacity() != f.Capacity() || b.K() != f.K() {
+		t.Errorf("Expected m=%d, k=%d, got m=%d, k=%d", f.Capacity(), f.K(), b.Capacity(), b.K())
+	}
+
+	for i := 0; i < 1000; i++ {
+		data := []byte(strconv.Itoa(i))
+		if b.Test(data) != f.Test(data) {
+			t.Errorf("Expected membership of %d to match", i)
+		}
+	}
+}
+
 func BenchmarkCountingAdd(b *testing.B) {
 	b.StopTimer()
 	f := NewDefaultCountingBloomFilter(100000, 0.1)
@@ -238,3 +428,17 @@ func BenchmarkCountingTestAndRemove(b *testing.B) {
 		f.TestAndRemove(data[n])
 	}
 }
+
+func BenchmarkCountingMerge(b *testing.B) {
+	b.StopTimer()
+	f1 := NewDefaultCountingBloomFilter(100000, 0.1)
+	f2 := NewDefaultCountingBloomFilter(100000, 0.1)
+	for i := 0; i < 100000; i++ {
+		f2.Add([]byte(strconv.Itoa(i)))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f1.Merge(f2)
+	}
+}
@@ -0,0 +1,299 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"io"
+	"math/rand"
+)
+
+// CountingCuckooFilter implements a Cuckoo Filter for multisets, which
+// estimates the number of times each element was added. It stores a small
+// counter alongside each fingerprint in the buckets of a Cuckoo Filter. Adding
+// an element increments the counters of the entries holding its fingerprint
+// and, once they're saturated, overflows into additional entries in either of
+// its buckets. An element can therefore be added up to 2b times the counter
+// max value before the filter is full, where b is the bucket size.
+//
+// Like the Cuckoo Filter, there is a non-zero probability of false positives,
+// in which case the count of an element includes the count of another
+// element with the same fingerprint and buckets. Counts are never
+// underestimated.
+type CountingCuckooFilter struct {
+	filter *CuckooFilter // fingerprints with their counters
+	max    uint32        // counter max value
+	total  uint64        // number of items added
+}
+
+// NewCountingCuckooFilter creates a new Counting Cuckoo Filter optimized to
+// store n distinct items with c bits allocated for each counter and a
+// specified target false-positive rate. Use NewDefaultCountingCuckooFilter if
+// you don't want to calculate c.
+func NewCountingCuckooFilter(n uint, c uint8, fpRate float64) *CountingCuckooFilter {
+	if c == 0 {
+		c = 1
+	} else if c > 32 {
+		c = 32
+	}
+
+	return &CountingCuckooFilter{
+		filter: NewCuckooFilter(n, fpRate).withValues(uint(c)),
+		max:    uint32(1)<<c - 1,
+	}
+}
+
+// NewDefaultCountingCuckooFilter creates a new Counting Cuckoo Filter
+// optimized to store n distinct items with a specified target false-positive
+// rate, using 4-bit counters.
+func NewDefaultCountingCuckooFilter(n uint, fpRate float64) *CountingCuckooFilter {
+	return NewCountingCuckooFilter(n, 4, fpRate)
+}
+
+// Capacity returns the number of distinct items the filter can store.
+func (c *CountingCuckooFilter) Capacity() uint {
+	return c.filter.Capacity()
+}
+
+// TotalCount returns the number of items added to the filter.
+func (c *CountingCuckooFilter) TotalCount() uint64 {
+	return c.total
+}
+
+// MemoryUsage returns the number of bytes used to store the fingerprints and
+// counters.
+func (c *CountingCuckooFilter) MemoryUsage() uint {
+	return c.filter.MemoryUsage()
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives.
+func (c *CountingCuckooFilter) Test(data []byte) bool {
+	return c.filter.Test(data)
+}
+
+// Count returns the approximate number of times the data was added.
+func (c *CountingCuckooFilter) Count(data []byte) uint64 {
+	var (
+		i1, i2, f = c.filter.components(data)
+		count     uint64
+	)
+	for _, i := range c.filter.candidates(i1, i2) {
+		for j := uint(0); j < c.filter.b; j++ {
+			if c.filter.entry(i, j) == f {
+				count += uint64(c.filter.value(i, j))
+			}
+		}
+	}
+	for idx, entry := range c.filter.stash {
+		if c.filter.stashMatches(idx, i1, i2, f) {
+			count += uint64(entry.v)
+		}
+	}
+	return count
+}
+
+// Add will add the data to the filter once. ErrFilterFull is returned if the
+// filter is full, in which case the filter is left unchanged.
+func (c *CountingCuckooFilter) Add(data []byte) error {
+	return c.AddN(data, 1)
+}
+
+// AddN will add the data to the filter n times. ErrFilterFull is returned if
+// the filter is full, in which case the filter is left unchanged.
+func (c *CountingCuckooFilter) AddN(data []byte, n uint64) error {
+	var (
+		i1, i2, f = c.filter.components(data)
+		remaining = n
+	)
+
+	// Increment the counters of existing entries until they're saturated.
+	for _, i := range c.filter.candidates(i1, i2) {
+		for j := uint(0); j < c.filter.b && remaining > 0; j++ {
+			if c.filter.entry(i, j) != f {
+				continue
+			}
+			count := c.filter.value(i, j)
+			delta := min64(uint64(c.max-count), remaining)
+			c.filter.put(i, j, f, count+uint32(delta))
+			remaining -= delta
+		}
+	}
+	for idx := range c.filter.stash {
+		if remaining == 0 {
+			break
+		}
+		if !c.filter.stashMatches(idx, i1, i2, f) {
+			continue
+		}
+		delta := min64(uint64(c.max-c.filter.stash[idx].v), remaining)
+		c.filter.stash[idx].v += uint32(delta)
+		remaining -= delta
+	}
+
+	// Overflow into additional entries.
+	for remaining > 0 {
+		delta := min64(uint64(c.max), remaining)
+		if err := c.filter.add(i1, i2, f, uint32(delta)); err != nil {
+			c.remove(i1, i2, f, n-remaining)
+			return err
+		}
+		remaining -= delta
+	}
+
+	c.total += n
+	return nil
+}
+
+// TestAndRemove will test for membership of the data and remove it from the
+// filter once if it exists. Returns true if the data was a member, false if
+// not.
+func (c *CountingCuckooFilter) TestAndRemove(data []byte) bool {
+	return c.RemoveN(data, 1) == 1
+}
+
+// RemoveN will remove the data from the filter up to n times. It returns the
+// number of times the data was removed, which is less than n if the data was
+// added fewer times.
+func (c *CountingCuckooFilter) RemoveN(data []byte, n uint64) uint64 {
+	i1, i2, f := c.filter.components(data)
+	removed := c.remove(i1, i2, f, n)
+	c.total -= removed
+	return removed
+}
+
+// Reset restores the filter to its original state. It returns the filter to
+// allow for chaining.
+func (c *CountingCuckooFilter) Reset() *CountingCuckooFilter {
+	c.filter.Reset()
+	c.total = 0
+	return c
+}
+
+// remove decrements the counters of the entries holding the fingerprint up to
+// n times in total, emptying entries whose counters reach zero. It returns the
+// number of times the fingerprint was removed.
+func (c *CountingCuckooFilter) remove(i1, i2 uint, f uint32, n uint64) uint64 {
+	removed := uint64(0)
+
+	// Remove from the stash first so its entries can be moved back into
+	// the buckets.
+	for idx := 0; idx < len(c.filter.stash) && removed < n; idx++ {
+		if !c.filter.stashMatches(idx, i1, i2, f) {
+			continue
+		}
+		delta := min64(uint64(c.filter.stash[idx].v), n-removed)
+		c.filter.stash[idx].v -= uint32(delta)
+		removed += delta
+		if c.filter.stash[idx].v == 0 {
+			c.filter.stash = append(c.filter.stash[:idx], c.filter.stash[idx+1:]...)
+			c.filter.count--
+			idx--
+		}
+	}
+
+	freed := false
+	for _, i := range c.filter.candidates(i1, i2) {
+		for j := uint(0); j < c.filter.b && removed < n; j++ {
+			if c.filter.entry(i, j) != f {
+				continue
+			}
+			count := c.filter.value(i, j)
+			delta := min64(uint64(count), n-removed)
+			removed += delta
+			if uint64(count) == delta {
+				c.filter.put(i, j, 0, 0)
+				c.filter.count--
+				freed = true
+				continue
+			}
+			c.filter.put(i, j, f, count-uint32(delta))
+		}
+	}
+
+	if freed {
+		c.filter.unstash()
+	}
+	return removed
+}
+
+// SetHash sets the hashing function used in the filter.
+// For the effect on false positive rates see: https://github.com/tylertreat/BoomFilters/pull/1
+func (c *CountingCuckooFilter) SetHash(h hash.Hash32) {
+	c.filter.SetHash(h)
+}
+
+// SetRandSource sets the source used to pick the entries to relocate when
+// inserting into full buckets, which defaults to the global math/rand source.
+// Filters using the same seeded source end up in identical states for
+// identical input. The state of a source created with NewRandSource is
+// persisted by WriteTo.
+func (c *CountingCuckooFilter) SetRandSource(src rand.Source) {
+	c.filter.SetRandSource(src)
+}
+
+// WriteTo writes a binary representation of the CountingCuckooFilter to an
+// i/o stream. It returns the number of bytes written.
+func (c *CountingCuckooFilter) WriteTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, c.total)
+	if err != nil {
+		return 0, err
+	}
+	num, err := c.filter.WriteTo(stream)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.Size(uint64(0))) + num, nil
+}
+
+// ReadFrom reads a binary representation of CountingCuckooFilter (such as
+// might have been written by WriteTo()) from an i/o stream. It returns the
+// number of bytes read.
+func (c *CountingCuckooFilter) ReadFrom(stream io.Reader) (int64, error) {
+	var total uint64
+	err := binary.Read(stream, binary.BigEndian, &total)
+	if err != nil {
+		return 0, err
+	}
+	filter := &CuckooFilter{}
+	if c.filter != nil {
+		filter.hash = c.filter.hash
+	}
+	num, err := filter.ReadFrom(stream)
+	if err != nil {
+		return 0, err
+	}
+
+	c.filter = filter
+	c.max = uint32(1)<<filter.v - 1
+	c.total = total
+	return int64(binary.Size(uint64(0))) + num, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (c *CountingCuckooFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := c.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (c *CountingCuckooFilter) GobDecode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := c.ReadFrom(buf)
+
+	return err
+}
+
+// min64 returns the smaller of two uint64 values.
+func min64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,257 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/gob"
+	"hash/fnv"
+	"strconv"
+	"testing"
+)
+
+// Ensures that Count returns the number of times each element was added.
+func TestCountingCuckooCount(t *testing.T) {
+	f := NewDefaultCountingCuckooFilter(1000, 0.001)
+	for i := 0; i < 100; i++ {
+		if err := f.AddN([]byte(strconv.Itoa(i)), uint64(i%10)+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Add([]byte(`0`))
+
+	if count := f.Count([]byte(`0`)); count != 2 {
+		t.Errorf("Expected 2, got %d", count)
+	}
+
+	for i := 1; i < 100; i++ {
+		if count := f.Count([]byte(strconv.Itoa(i))); count != uint64(i%10)+1 {
+			t.Errorf("Expected %d, got %d", i%10+1, count)
+		}
+	}
+
+	if count := f.Count([]byte(`100`)); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+
+	if total := f.TotalCount(); total != 551 {
+		t.Errorf("Expected 551, got %d", total)
+	}
+
+	if !f.Test([]byte(`0`)) {
+		t.Error("`0` should be a member")
+	}
+}
+
+// Ensures that counts beyond the counter max value overflow into additional
+// entries and the filter is left unchanged once they're exhausted.
+func TestCountingCuckooOverflow(t *testing.T) {
+	f := NewDefaultCountingCuckooFilter(1000, 0.01)
+	f.SetRandSource(NewRandSource(42))
+
+	if err := f.AddN([]byte(`a`), 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := f.Count([]byte(`a`)); count != 100 {
+		t.Errorf("Expected 100, got %d", count)
+	}
+
+	// Each entry holds up to 15, so 100 is spread across 7 entries.
+	if entries := f.filter.Count(); entries != 7 {
+		t.Errorf("Expected 7, got %d", entries)
+	}
+
+	// Both buckets and the stash hold up to 12 entries for `a`.
+	if err := f.AddN([]byte(`a`), 100); err != ErrFilterFull {
+		t.Errorf("Expected ErrFilterFull, got %v", err)
+	}
+
+	if count := f.Count([]byte(`a`)); count != 100 {
+		t.Errorf("Expected 100, got %d", count)
+	}
+
+	if err := f.AddN([]byte(`a`), 80); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := f.Count([]byte(`a`)); count != 180 {
+		t.Errorf("Expected 180, got %d", count)
+	}
+}
+
+// Ensures that RemoveN removes up to n occurrences and empties entries.
+func TestCountingCuckooRemoveN(t *testing.T) {
+	f := NewDefaultCountingCuckooFilter(1000, 0.01)
+	f.AddN([]byte(`a`), 100)
+	f.AddN([]byte(`b`), 3)
+
+	if removed := f.RemoveN([]byte(`a`), 30); removed != 30 {
+		t.Errorf("Expected 30, got %d", removed)
+	}
+
+	if count := f.Count([]byte(`a`)); count != 70 {
+		t.Errorf("Expected 70, got %d", count)
+	}
+
+	if removed := f.RemoveN([]byte(`a`), 100); removed != 70 {
+		t.Errorf("Expected 70, got %d", removed)
+	}
+
+	if f.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+
+	if !f.TestAndRemove([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+
+	if count := f.Count([]byte(`b`)); count != 2 {
+		t.Errorf("Expected 2, got %d", count)
+	}
+
+	if total := f.TotalCount(); total != 2 {
+		t.Errorf("Expected 2, got %d", total)
+	}
+
+	if entries := f.filter.Count(); entries != 1 {
+		t.Errorf("Expected 1, got %d", entries)
+	}
+
+	if f.TestAndRemove([]byte(`c`)) {
+		t.Error("`c` should not be a member")
+	}
+}
+
+// Ensures that Reset clears the filter.
+func TestCountingCuckooReset(t *testing.T) {
+	f := NewDefaultCountingCuckooFilter(100, 0.01)
+	for i := 0; i < 100; i++ {
+		f.AddN([]byte(strconv.Itoa(i)), 5)
+	}
+
+	if f.Reset() != f {
+		t.Error("Returned CountingCuckooFilter should be the same instance")
+	}
+
+	if total := f.TotalCount(); total != 0 {
+		t.Errorf("Expected 0, got %d", total)
+	}
+
+	if count := f.Count([]byte(`0`)); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+}
+
+// Ensures that the filter can be serialized and resumed, including counts
+// held in the stash.
+func TestCountingCuckooSerialization(t *testing.T) {
+	f := NewCountingCuckooFilter(1000, 2, 0.01)
+	f.SetRandSource(NewRandSource(42))
+	f.AddN([]byte(`a`), 30)
+	for i := 0; i < 100; i++ {
+		f.AddN([]byte(strconv.Itoa(i)), uint64(i%5)+1)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(f); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &CountingCuckooFilter{}
+	if err := gob.NewDecoder(&buf).Decode(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	wn, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := NewDefaultCountingCuckooFilter(10, 0.1)
+	rn, err := read.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wn != rn {
+		t.Errorf("Expected %d bytes read, got %d", wn, rn)
+	}
+
+	for _, filter := range []*CountingCuckooFilter{decoded, read} {
+		if total := filter.TotalCount(); total != f.TotalCount() {
+			t.Errorf("Expected %d, got %d", f.TotalCount(), total)
+		}
+
+		if count := filter.Count([]byte(`a`)); count != 30 {
+			t.Errorf("Expected 30, got %d", count)
+		}
+
+		for i := 0; i < 100; i++ {
+			if count := filter.Count([]byte(strconv.Itoa(i))); count != uint64(i%5)+1 {
+				t.Errorf("Expected %d, got %d", i%5+1, count)
+			}
+		}
+
+		// Counters are still limited to 2 bits.
+		if err := filter.AddN([]byte(`a`), 3); err != nil {
+			t.Fatal(err)
+		}
+		if count := filter.Count([]byte(`a`)); count != 33 {
+			t.Errorf("Expected 33, got %d", count)
+		}
+	}
+}
+
+// Ensures that a filter with a custom hash can be resumed by a filter using the
+// same hash.
+func TestCountingCuckooSerializationCustomHash(t *testing.T) {
+	f := NewCountingCuckooFilter(1000, 4, 0.01)
+	f.SetHash(fnv.New32a())
+	for i := 0; i < 100; i++ {
+		f.AddN([]byte(strconv.Itoa(i)), uint64(i%5)+1)
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	read := NewCountingCuckooFilter(10, 4, 0.1)
+	read.SetHash(fnv.New32a())
+	if _, err := read.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		if count := read.Count([]byte(strconv.Itoa(i))); count != uint64(i%5)+1 {
+			t.Errorf("Expected %d, got %d", i%5+1, count)
+		}
+	}
+}
+
+func BenchmarkCountingCuckooAdd(b *testing.B) {
+	b.StopTimer()
+	f := NewDefaultCountingCuckooFilter(100000, 0.01)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i % 100000))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
+
+func BenchmarkCountingCuckooCount(b *testing.B) {
+	b.StopTimer()
+	f := NewDefaultCountingCuckooFilter(100000, 0.01)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i % 100000))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Count(data[n])
+	}
+}
@@ -45,9 +45,8 @@ type CountMinSketch struct {
 // affect the space and time complexity.
 func NewCountMinSketch(epsilon, delta float64) *CountMinSketch {
 	var (
-		width  = uint(math.Ceil(math.E / epsilon))
-		depth  = uint(math.Ceil(math.Log(1 / delta)))
-		matrix = make([][]uint64, depth)
+		width, depth = cmsDimensions(epsilon, delta)
+		matrix       = make([][]uint64, depth)
 	)
 
 	for i := uint(0); i < depth; i++ {
@@ -64,6 +63,18 @@ func NewCountMinSketch(epsilon, delta float64) *CountMinSketch {
 	}
 }
 
+// cmsDimensions returns the width and depth of a Count-Min Sketch matrix whose
+// relative accuracy is within a factor of epsilon with probability delta.
+func cmsDimensions(epsilon, delta float64) (uint, uint) {
+	return uint(math.Ceil(math.E / epsilon)), uint(math.Ceil(math.Log(1 / delta)))
+}
+
+// cmsColumn returns the column of the counter in row i of a Count-Min Sketch
+// matrix of the given width for data with the given hash kernel.
+func cmsColumn(lower, upper uint32, i, width uint) uint {
+	return (uint(lower) + uint(upper)*i) % width
+}
+
 // Epsilon returns the relative-accuracy factor, epsilon.
 func (c *CountMinSketch) Epsilon() float64 {
 	return c.epsilon
@@ -92,7 +103,7 @@ func (c *CountMinSketch) AddN(data []byte, n uint64) *CountMinSketch {
 
 	// Increment count in each row by n.
 	for i := uint(0); i < c.depth; i++ {
-		c.matrix[i][(uint(lower)+uint(upper)*i)%c.width] += n
+		c.matrix[i][cmsColumn(lower, upper, i, c.width)] += n
 	}
 
 	c.count += n
@@ -109,7 +120,7 @@ func (c *CountMinSketch) Count(data []byte) uint64 {
 
 	for i := uint(0); i < c.depth; i++ {
 		count = uint64(math.Min(float64(count),
-			float64(c.matrix[i][(uint(lower)+uint(upper)*i)%c.width])))
+			float64(c.matrix[i][cmsColumn(lower, upper, i, c.width)])))
 	}
 
 	return count
@@ -264,7 +275,7 @@ func (c *CountMinSketch) traverseDepth(data []byte) ([]*uint64, uint64) {
 	)
 
 	for i := uint(0); i < c.depth; i++ {
-		h[i] = &c.matrix[i][(uint(lower)+uint(upper)*i)%c.width]
+		h[i] = &c.matrix[i][cmsColumn(lower, upper, i, c.width)]
 		count = uint64(math.Min(float64(count), float64(*h[i])))
 	}
 
@@ -6,43 +6,39 @@ import (
 	"errors"
 	"hash"
 	"hash/fnv"
+	"io"
 	"math"
 	"math/rand"
+	"sync"
 )
 
 // maxNumKicks is the maximum number of relocations to attempt when inserting
 // an element before considering the filter full.
 const maxNumKicks = 500
 
-// bucket consists of a set of []byte entries.
-type bucket [][]byte
+// cuckooStashSize is the number of fingerprints which can be held in the
+// victim stash when relocating fails.
+const cuckooStashSize = 4
 
-// contains indicates if the given fingerprint is contained in one of the
-// bucket's entries.
-func (b bucket) contains(f []byte) bool {
-	return b.indexOf(f) != -1
-}
+// ErrFilterFull is returned when an element can't be added because the filter
+// is full. The filter is left unchanged.
+var ErrFilterFull = errors.New("full")
 
-// indexOf returns the entry index of the given fingerprint or -1 if it's not
-// in the bucket.
-func (b bucket) indexOf(f []byte) int {
-	for i, fingerprint := range b {
-		if bytes.Equal(f, fingerprint) {
-			return i
-		}
-	}
-	return -1
+// stashEntry is a fingerprint which couldn't be relocated into either of its
+// buckets, along with the hash value of one of them and its value.
+type stashEntry struct {
+	i uint
+	f uint32
+	v uint32
 }
 
-// getEmptyEntry returns the index of the next available entry in the bucket or
-// an error if it's full.
-func (b bucket) getEmptyEntry() (int, error) {
-	for i, fingerprint := range b {
-		if fingerprint == nil {
-			return i, nil
-		}
-	}
-	return -1, errors.New("full")
+// kick is a relocation performed while inserting, recorded so it can be
+// rolled back.
+type kick struct {
+	i, j        uint   // hash value of the bucket and entry index
+	f           uint32 // fingerprint which was inserted
+	victim      uint32 // fingerprint which was displaced
+	victimValue uint32 // value which was displaced
 }
 
 // CuckooFilter implements a Cuckoo Bloom filter as described by Andersen,
@@ -61,31 +57,62 @@ func (b bucket) getEmptyEntry() (int, error) {
 // false-positive rates, cuckoo filters have lower space overhead than
 // space-optimized Bloom filters.
 type CuckooFilter struct {
-	buckets []bucket
-	hash    hash.Hash32 // hash function (used for fingerprint and hash)
-	m       uint        // number of buckets
-	b       uint        // number of entries per bucket
-	f       uint        // length of fingerprints (in bytes)
-	count   uint        // number of items in the filter
-	n       uint        // filter capacity
+	buckets    *Buckets     // m buckets of b fingerprints, zero if empty
+	values     *Buckets     // value stored alongside each fingerprint, if any
+	stash      []stashEntry // fingerprints which couldn't be relocated
+	hash       hash.Hash32  // hash function (used for fingerprint and hash)
+	m          uint         // number of buckets
+	b          uint         // number of entries per bucket
+	f          uint         // length of fingerprints (in bits)
+	v          uint         // length of values (in bits), zero if none
+	count      uint         // number of items in the filter
+	n          uint         // filter capacity
+	semiSorted bool         // whether buckets use semi-sorted encoding
+	rand       randGen      // source of entries to relocate
 }
 
 // NewCuckooFilter creates a new Cuckoo Bloom filter optimized to store n items
-// with a specified target false-positive rate.
+// with a specified target false-positive rate. It uses buckets of 4 entries
+// and the shortest fingerprints which satisfy the false-positive rate.
+//
+// For compatibility, the number of buckets is sized as in earlier versions,
+// which over-provisions the filter well beyond its maximum load factor. For
+// example, 1,000,000 items at a false-positive rate of 0.001 get 8,388,608
+// buckets, about 54MB. Use NewCustomCuckooFilter for a filter sized to the
+// load factor its bucket size supports.
 func NewCuckooFilter(n uint, fpRate float64) *CuckooFilter {
-	var (
-		b       = uint(4)
-		f       = calculateF(b, fpRate)
-		m       = power2(n / f * 8)
-		buckets = make([]bucket, m)
-	)
+	b := uint(4)
+	return newCuckooFilter(power2(n/fingerprintBytes(b, fpRate)*8), b, calculateF(b, fpRate), n)
+}
+
+// NewCustomCuckooFilter creates a new Cuckoo Bloom filter which stores n
+// items in buckets of b entries with fingerprints of f bits, which must be
+// between 1 and 32. The false-positive rate is roughly 2b/2^f, so each bit
+// added to the fingerprints halves it. Larger buckets allow a higher load
+// factor at the cost of more fingerprint comparisons.
+func NewCustomCuckooFilter(n, b, f uint) *CuckooFilter {
+	if b == 0 {
+		b = 1
+	}
+	if f == 0 {
+		f = 1
+	} else if f > 32 {
+		f = 32
+	}
+
+	m := power2(uint(math.Ceil(float64(n) / (float64(b) * cuckooMaxLoad(b)))))
+	return newCuckooFilter(m, b, f, n)
+}
 
-	for i := uint(0); i < m; i++ {
-		buckets[i] = make(bucket, b)
+// newCuckooFilter creates a new Cuckoo Bloom filter with m buckets of b entries
+// and fingerprints of f bits, which has a capacity of n items.
+func newCuckooFilter(m, b, f, n uint) *CuckooFilter {
+	if m == 0 {
+		m = 1
 	}
 
 	return &CuckooFilter{
-		buckets: buckets,
+		buckets: NewBuckets(m*b, uint8(f)),
 		hash:    fnv.New32(),
 		m:       m,
 		b:       b,
@@ -94,11 +121,58 @@ func NewCuckooFilter(n uint, fpRate float64) *CuckooFilter {
 	}
 }
 
+// NewSemiSortedCuckooFilter creates a new Cuckoo Bloom filter optimized to
+// store n items with a specified target false-positive rate, using the
+// semi-sorting optimization from the Cuckoo Filter paper. Each bucket of 4
+// entries is kept sorted, so the 4-bit prefixes of its fingerprints can be
+// encoded together in 12 bits rather than 16, saving a bit per entry at the
+// cost of decoding buckets on every operation. Fingerprints are at least 5
+// bits.
+func NewSemiSortedCuckooFilter(n uint, fpRate float64) *CuckooFilter {
+	b := uint(4)
+	f := calculateF(b, fpRate)
+	if f < 5 {
+		f = 5
+	}
+
+	c := NewCustomCuckooFilter(n, b, f)
+	c.semiSorted = true
+	c.buckets = NewBuckets(c.m*c.bucketBits(), 1)
+	return c
+}
+
+// withValues allocates v bits alongside each fingerprint to store a value,
+// which is relocated along with the fingerprint. It returns the filter to
+// allow for chaining.
+func (c *CuckooFilter) withValues(v uint) *CuckooFilter {
+	if v > 32 {
+		v = 32
+	}
+	c.v = v
+	c.values = NewBuckets(c.m*c.b, uint8(v))
+	return c
+}
+
 // Buckets returns the number of buckets.
 func (c *CuckooFilter) Buckets() uint {
 	return c.m
 }
 
+// BucketSize returns the number of entries per bucket.
+func (c *CuckooFilter) BucketSize() uint {
+	return c.b
+}
+
+// SemiSorted indicates if buckets use the semi-sorted encoding.
+func (c *CuckooFilter) SemiSorted() bool {
+	return c.semiSorted
+}
+
+// FingerprintBits returns the length of fingerprints in bits.
+func (c *CuckooFilter) FingerprintBits() uint {
+	return c.f
+}
+
 // Capacity returns the number of items the filter can store.
 func (c *CuckooFilter) Capacity() uint {
 	return c.n
@@ -109,39 +183,43 @@ func (c *CuckooFilter) Count() uint {
 	return c.count
 }
 
+// MemoryUsage returns the number of bytes used to store the fingerprints.
+func (c *CuckooFilter) MemoryUsage() uint {
+	usage := uint(len(c.buckets.data))
+	if c.values != nil {
+		usage += uint(len(c.values.data))
+	}
+	return usage
+}
+
 // Test will test for membership of the data and returns true if it is a
 // member, false if not. This is a probabilistic test, meaning there is a
 // non-zero probability of false positives.
 func (c *CuckooFilter) Test(data []byte) bool {
-	i1, i2, f := c.components(data)
-
-	// If either bucket contains f, it's a member.
-	return c.buckets[i1%c.m].contains(f) || c.buckets[i2%c.m].contains(f)
+	return c.contains(c.components(data))
 }
 
-// Add will add the data to the Cuckoo Filter. It returns an error if the
-// filter is full. If the filter is full, an item is removed to make room for
-// the new item. This introduces a possibility for false negatives. To avoid
-// this, use Count and Capacity to check if the filter is full before adding an
-// item.
+// Add will add the data to the Cuckoo Filter. If existing items can't be
+// relocated to make room, the last one displaced is held in a small victim
+// stash. ErrFilterFull is returned if the stash is also full, in which case
+// the relocations are rolled back and the filter is left unchanged.
 func (c *CuckooFilter) Add(data []byte) error {
-	return c.add(c.components(data))
+	i1, i2, f := c.components(data)
+	return c.add(i1, i2, f, 0)
 }
 
 // TestAndAdd is equivalent to calling Test followed by Add. It returns true if
-// the data is a member, false if not. An error is returned if the filter is
-// full. If the filter is full, an item is removed to make room for the new
-// item. This introduces a possibility for false negatives. To avoid this, use
-// Count and Capacity to check if the filter is full before adding an item.
+// the data is a member, false if not. ErrFilterFull is returned if the data
+// isn't a member and the filter is full, in which case the filter is left
+// unchanged.
 func (c *CuckooFilter) TestAndAdd(data []byte) (bool, error) {
 	i1, i2, f := c.components(data)
 
-	// If either bucket contains f, it's a member.
-	if c.buckets[i1%c.m].contains(f) || c.buckets[i2%c.m].contains(f) {
+	if c.contains(i1, i2, f) {
 		return true, nil
 	}
 
-	return false, c.add(i1, i2, f)
+	return false, c.add(i1, i2, f, 0)
 }
 
 // TestAndRemove will test for membership of the data and remove it from the
@@ -149,85 +227,401 @@ func (c *CuckooFilter) TestAndAdd(data []byte) (bool, error) {
 func (c *CuckooFilter) TestAndRemove(data []byte) bool {
 	i1, i2, f := c.components(data)
 
+	// Try to remove from the stash.
+	if idx := c.stashIndexOf(i1, i2, f); idx != -1 {
+		c.stash = append(c.stash[:idx], c.stash[idx+1:]...)
+		c.count--
+		return true
+	}
+
 	// Try to remove from bucket[i1].
-	b1 := c.buckets[i1%c.m]
-	if idx := b1.indexOf(f); idx != -1 {
-		b1[idx] = nil
+	if idx := c.indexOf(i1, f); idx != -1 {
+		c.put(i1, uint(idx), 0, 0)
 		c.count--
+		c.unstash()
 		return true
 	}
 
 	// Try to remove from bucket[i2].
-	b2 := c.buckets[i2%c.m]
-	if idx := b2.indexOf(f); idx != -1 {
-		b2[idx] = nil
+	if idx := c.indexOf(i2, f); idx != -1 {
+		c.put(i2, uint(idx), 0, 0)
 		c.count--
+		c.unstash()
 		return true
 	}
 
 	return false
 }
 
+// Fingerprints calls fn for each fingerprint stored in the filter, including
+// the stash, along with the index of a bucket it can be stored in. Iteration
+// stops if fn returns false. The filter must not be modified during iteration.
+func (c *CuckooFilter) Fingerprints(fn func(bucket uint, fingerprint uint32) bool) {
+	c.each(func(i uint, f, v uint32) bool {
+		return fn(i%c.m, f)
+	})
+}
+
+// Merge adds every fingerprint stored in the other filter to this one, like
+// adding each element of the other filter, so elements in both are stored
+// twice. Fingerprints are re-inserted through their alternate buckets, so the
+// filters must have the same number of buckets, bucket size, fingerprint
+// length, and bucket encoding, and use the same hash function. Fingerprints
+// which don't fit are skipped. It returns the number of fingerprints skipped
+// along with ErrFilterFull if there were any.
+func (c *CuckooFilter) Merge(other *CuckooFilter) (uint, error) {
+	if c.m != other.m {
+		return 0, errors.New("number of buckets must match")
+	}
+	if c.b != other.b {
+		return 0, errors.New("bucket size must match")
+	}
+	if c.f != other.f {
+		return 0, errors.New("fingerprint length must match")
+	}
+	if c.v != other.v {
+		return 0, errors.New("value length must match")
+	}
+	if c.semiSorted != other.semiSorted {
+		return 0, errors.New("bucket encoding must match")
+	}
+	if !sameHash32(c.hash, other.hash) {
+		return 0, errors.New("hash functions must match")
+	}
+
+	// Collect the fingerprints first in case the filters are the same.
+	var entries []stashEntry
+	other.each(func(i uint, f, v uint32) bool {
+		entries = append(entries, stashEntry{i: i, f: f, v: v})
+		return true
+	})
+
+	overflow := uint(0)
+	for _, entry := range entries {
+		if c.add(entry.i, c.altIndex(entry.i, entry.f), entry.f, entry.v) != nil {
+			overflow++
+		}
+	}
+
+	if overflow > 0 {
+		return overflow, ErrFilterFull
+	}
+	return 0, nil
+}
+
+// Rebuild returns a new filter with the same number of buckets and
+// fingerprint length but b entries per bucket, holding every fingerprint
+// stored in this one. Since an element's buckets can't be recovered from its
+// fingerprint for a different number of buckets, this is how a filter grows
+// without the original elements: doubling the bucket size doubles the
+// capacity. Semi-sorting is kept if b is 4. ErrFilterFull is returned if the
+// fingerprints don't fit.
+func (c *CuckooFilter) Rebuild(b uint) (*CuckooFilter, error) {
+	if b == 0 {
+		b = 1
+	}
+
+	rebuilt := &CuckooFilter{
+		buckets: NewBuckets(c.m*b, uint8(c.f)),
+		hash:    c.hash,
+		m:       c.m,
+		b:       b,
+		f:       c.f,
+		n:       c.n * b / c.b,
+	}
+	if c.semiSorted && b == 4 {
+		rebuilt.semiSorted = true
+		rebuilt.buckets = NewBuckets(rebuilt.m*rebuilt.bucketBits(), 1)
+	}
+	if c.values != nil {
+		rebuilt.withValues(c.v)
+	}
+	rebuilt.SetRandSource(c.rand.source)
+
+	var err error
+	c.each(func(i uint, f, v uint32) bool {
+		err = rebuilt.add(i, rebuilt.altIndex(i, f), f, v)
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rebuilt, nil
+}
+
+// each calls fn for each fingerprint stored in the buckets and the stash,
+// along with the hash value of one of its buckets and its value, until fn
+// returns false.
+func (c *CuckooFilter) each(fn func(i uint, f, v uint32) bool) {
+	for i := uint(0); i < c.m; i++ {
+		for j := uint(0); j < c.b; j++ {
+			if f := c.entry(i, j); f != 0 && !fn(i, f, c.value(i, j)) {
+				return
+			}
+		}
+	}
+	for _, entry := range c.stash {
+		if !fn(entry.i, entry.f, entry.v) {
+			return
+		}
+	}
+}
+
 // Reset restores the Bloom filter to its original state. It returns the filter
 // to allow for chaining.
 func (c *CuckooFilter) Reset() *CuckooFilter {
-	buckets := make([]bucket, c.m)
-	for i := uint(0); i < c.m; i++ {
-		buckets[i] = make(bucket, c.b)
+	c.buckets.Reset()
+	if c.values != nil {
+		c.values.Reset()
 	}
-	c.buckets = buckets
+	c.stash = nil
 	c.count = 0
 	return c
 }
 
-// add will insert the fingerprint into the filter returning an error if the
-// filter is full.
-func (c *CuckooFilter) add(i1, i2 uint, f []byte) error {
+// contains indicates if either bucket or the stash contains the fingerprint.
+func (c *CuckooFilter) contains(i1, i2 uint, f uint32) bool {
+	return c.indexOf(i1, f) != -1 || c.indexOf(i2, f) != -1 ||
+		c.stashIndexOf(i1, i2, f) != -1
+}
+
+// add will insert the fingerprint and its value into the filter returning an
+// error if the filter is full.
+func (c *CuckooFilter) add(i1, i2 uint, f, v uint32) error {
 	// Try to insert into bucket[i1].
-	b1 := c.buckets[i1%c.m]
-	if idx, err := b1.getEmptyEntry(); err == nil {
-		b1[idx] = f
+	if idx := c.indexOf(i1, 0); idx != -1 {
+		c.put(i1, uint(idx), f, v)
 		c.count++
 		return nil
 	}
 
 	// Try to insert into bucket[i2].
-	b2 := c.buckets[i2%c.m]
-	if idx, err := b2.getEmptyEntry(); err == nil {
-		b2[idx] = f
+	if idx := c.indexOf(i2, 0); idx != -1 {
+		c.put(i2, uint(idx), f, v)
 		c.count++
 		return nil
 	}
 
 	// Must relocate existing items.
-	i := i1
+	var (
+		i     = i1
+		kicks []kick
+	)
 	for n := 0; n < maxNumKicks; n++ {
-		bucketIdx := i % c.m
-		entryIdx := rand.Intn(int(c.b))
-		f, c.buckets[bucketIdx][entryIdx] = c.buckets[bucketIdx][entryIdx], f
-		i = i ^ uint(binary.BigEndian.Uint32(c.computeHash(f)))
-		b := c.buckets[i%c.m]
-		if idx, err := b.getEmptyEntry(); err == nil {
-			b[idx] = f
+		entryIdx := uint(c.rand.Intn(int(c.b)))
+		victim, victimValue := c.entry(i, entryIdx), c.value(i, entryIdx)
+		c.put(i, entryIdx, f, v)
+		kicks = append(kicks, kick{i: i, j: entryIdx, f: f, victim: victim, victimValue: victimValue})
+		f, v = victim, victimValue
+		i = c.altIndex(i, f)
+		if idx := c.indexOf(i, 0); idx != -1 {
+			c.put(i, uint(idx), f, v)
 			c.count++
 			return nil
 		}
 	}
 
-	return errors.New("full")
+	// Hold the last victim in the stash.
+	if len(c.stash) < cuckooStashSize {
+		c.stash = append(c.stash, stashEntry{i: i, f: f, v: v})
+		c.count++
+		return nil
+	}
+
+	// Undo the relocations so no existing item is lost. Entries in semi-sorted
+	// buckets are found by fingerprint since sorting reorders them.
+	for n := len(kicks) - 1; n >= 0; n-- {
+		j := kicks[n].j
+		if c.semiSorted {
+			j = uint(c.indexOf(kicks[n].i, kicks[n].f))
+		}
+		c.put(kicks[n].i, j, kicks[n].victim, kicks[n].victimValue)
+	}
+	return ErrFilterFull
+}
+
+// stashIndexOf returns the index of the given fingerprint in the stash for
+// either of the hash values or -1 if it's not in the stash.
+func (c *CuckooFilter) stashIndexOf(i1, i2 uint, f uint32) int {
+	for idx := range c.stash {
+		if c.stashMatches(idx, i1, i2, f) {
+			return idx
+		}
+	}
+	return -1
+}
+
+// stashMatches indicates if the stash entry at the given index holds the
+// fingerprint for either of the hash values.
+func (c *CuckooFilter) stashMatches(idx int, i1, i2 uint, f uint32) bool {
+	entry := c.stash[idx]
+	return entry.f == f && (entry.i%c.m == i1%c.m || entry.i%c.m == i2%c.m)
+}
+
+// candidates returns the hash values of the distinct buckets an element with
+// the given hash values can be stored in.
+func (c *CuckooFilter) candidates(i1, i2 uint) []uint {
+	if i1%c.m == i2%c.m {
+		return []uint{i1}
+	}
+	return []uint{i1, i2}
+}
+
+// unstash moves stashed fingerprints back into either of their buckets if
+// there's an empty entry.
+func (c *CuckooFilter) unstash() {
+	for idx := 0; idx < len(c.stash); idx++ {
+		entry := c.stash[idx]
+		for _, i := range []uint{entry.i, c.altIndex(entry.i, entry.f)} {
+			if j := c.indexOf(i, 0); j != -1 {
+				c.put(i, uint(j), entry.f, entry.v)
+				c.stash = append(c.stash[:idx], c.stash[idx+1:]...)
+				idx--
+				break
+			}
+		}
+	}
+}
+
+// entry returns the fingerprint stored in the given entry of the bucket for
+// hash value i, or zero if the entry is empty.
+func (c *CuckooFilter) entry(i, j uint) uint32 {
+	if c.semiSorted {
+		return c.readBucket(i)[j]
+	}
+	return c.buckets.getBits(((i%c.m)*c.b+j)*c.f, c.f)
+}
+
+// setEntry stores the fingerprint in the given entry of the bucket for hash
+// value i. A fingerprint of zero empties the entry. Semi-sorted buckets are
+// sorted again, which may move other entries.
+func (c *CuckooFilter) setEntry(i, j uint, f uint32) {
+	if c.semiSorted {
+		entries := c.readBucket(i)
+		entries[j] = f
+		c.writeBucket(i, entries)
+		return
+	}
+	c.buckets.setBits(((i%c.m)*c.b+j)*c.f, c.f, f)
+}
+
+// value returns the value stored alongside the fingerprint in the given entry
+// of the bucket for hash value i.
+func (c *CuckooFilter) value(i, j uint) uint32 {
+	if c.values == nil {
+		return 0
+	}
+	return c.values.getBits(((i%c.m)*c.b+j)*c.v, c.v)
+}
+
+// put stores the fingerprint and its value in the given entry of the bucket
+// for hash value i.
+func (c *CuckooFilter) put(i, j uint, f, v uint32) {
+	c.setEntry(i, j, f)
+	if c.values != nil {
+		c.values.setBits(((i%c.m)*c.b+j)*c.v, c.v, v)
+	}
+}
+
+// indexOf returns the entry index of the given fingerprint in the bucket for
+// hash value i or -1 if it's not in the bucket. Looking up a fingerprint of
+// zero returns the first empty entry.
+func (c *CuckooFilter) indexOf(i uint, f uint32) int {
+	if c.semiSorted {
+		for j, entry := range c.readBucket(i) {
+			if entry == f {
+				return j
+			}
+		}
+		return -1
+	}
+	for j := uint(0); j < c.b; j++ {
+		if c.entry(i, j) == f {
+			return int(j)
+		}
+	}
+	return -1
+}
+
+// bucketBits returns the number of bits used by each semi-sorted bucket: 12
+// for the encoded prefixes and the remaining bits of each fingerprint.
+func (c *CuckooFilter) bucketBits() uint {
+	return semiSortedPrefixBits + 4*(c.f-4)
+}
+
+// readBucket decodes the sorted entries of the semi-sorted bucket for hash
+// value i.
+func (c *CuckooFilter) readBucket(i uint) [4]uint32 {
+	var (
+		entries  [4]uint32
+		offset   = (i % c.m) * c.bucketBits()
+		prefixes = semiSortedTables().decode[c.buckets.getBits(offset, semiSortedPrefixBits)]
+		suffix   = c.f - 4
+	)
+	offset += semiSortedPrefixBits
+	for j := range entries {
+		entries[j] = uint32(prefixes[j]) << suffix
+		if suffix > 0 {
+			entries[j] |= c.buckets.getBits(offset+uint(j)*suffix, suffix)
+		}
+	}
+	return entries
+}
+
+// writeBucket sorts the entries and encodes them into the semi-sorted bucket
+// for hash value i.
+func (c *CuckooFilter) writeBucket(i uint, entries [4]uint32) {
+	for a := 1; a < len(entries); a++ {
+		for b := a; b > 0 && entries[b] < entries[b-1]; b-- {
+			entries[b], entries[b-1] = entries[b-1], entries[b]
+		}
+	}
+
+	var (
+		offset = (i % c.m) * c.bucketBits()
+		suffix = c.f - 4
+		key    uint32
+	)
+	for _, entry := range entries {
+		key = key<<4 | entry>>suffix
+	}
+	c.buckets.setBits(offset, semiSortedPrefixBits, uint32(semiSortedTables().encode[key]))
+	offset += semiSortedPrefixBits
+	if suffix == 0 {
+		return
+	}
+	for j, entry := range entries {
+		c.buckets.setBits(offset+uint(j)*suffix, suffix, entry&(1<<suffix-1))
+	}
 }
 
 // components returns the two hash values used to index into the buckets and
-// the fingerprint for the given element.
-func (c *CuckooFilter) components(data []byte) (uint, uint, []byte) {
+// the fingerprint for the given element. The hash is mixed into 64 bits
+// first, since hashes such as FNV-1 spread a change in the last byte only into
+// their low bits. Fingerprints are then taken from the high bits and buckets
+// are indexed by the low bits, so they don't overlap for any filter size.
+func (c *CuckooFilter) components(data []byte) (uint, uint, uint32) {
 	var (
-		hash = c.computeHash(data)
-		f    = hash[0:c.f]
-		i1   = uint(binary.BigEndian.Uint32(hash))
-		i2   = i1 ^ uint(binary.BigEndian.Uint32(c.computeHash(f)))
+		hash = mix64(uint64(binary.BigEndian.Uint32(c.computeHash(data))))
+		f    = uint32(hash >> (64 - c.f))
+		i1   = uint(uint32(hash))
 	)
 
-	return i1, i2, f
+	// Zero marks empty entries.
+	if f == 0 {
+		f = 1
+	}
+
+	return i1, c.altIndex(i1, f), f
+}
+
+// altIndex returns the alternate hash value for the fingerprint stored in the
+// bucket for hash value i. Applying it twice returns the original bucket.
+func (c *CuckooFilter) altIndex(i uint, f uint32) uint {
+	var fingerprint [4]byte
+	binary.BigEndian.PutUint32(fingerprint[:], f)
+	hash := mix64(uint64(binary.BigEndian.Uint32(c.computeHash(fingerprint[:]))))
+	return i ^ uint(uint32(hash))
 }
 
 // computeHash returns a 32-bit hash value for the given data.
@@ -244,9 +638,219 @@ func (c *CuckooFilter) SetHash(h hash.Hash32) {
 	c.hash = h
 }
 
-// calculateF returns the optimal fingerprint length in bytes for the given
+// SetRandSource sets the source used to pick the entries to relocate when
+// inserting into full buckets, which defaults to the global math/rand source.
+// Filters using the same seeded source end up in identical states for
+// identical input. The state of a source created with NewRandSource is
+// persisted by WriteTo.
+func (c *CuckooFilter) SetRandSource(src rand.Source) {
+	c.rand.setSource(src)
+}
+
+// WriteTo writes a binary representation of the CuckooFilter to an i/o stream.
+// It returns the number of bytes written.
+func (c *CuckooFilter) WriteTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, uint64(c.m))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(c.b))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(c.f))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(c.v))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(c.count))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(c.n))
+	if err != nil {
+		return 0, err
+	}
+	var semiSorted uint8
+	if c.semiSorted {
+		semiSorted = 1
+	}
+	err = binary.Write(stream, binary.BigEndian, semiSorted)
+	if err != nil {
+		return 0, err
+	}
+	numBytes := int64(6*binary.Size(uint64(0)) + binary.Size(uint8(0)))
+	num, err := c.buckets.WriteTo(stream)
+	if err != nil {
+		return 0, err
+	}
+	numBytes += num
+	if c.values != nil {
+		num, err = c.values.WriteTo(stream)
+		if err != nil {
+			return 0, err
+		}
+		numBytes += num
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(len(c.stash)))
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range c.stash {
+		err = binary.Write(stream, binary.BigEndian, uint64(entry.i))
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Write(stream, binary.BigEndian, entry.f)
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Write(stream, binary.BigEndian, entry.v)
+		if err != nil {
+			return 0, err
+		}
+	}
+	numBytes += int64((1+len(c.stash))*binary.Size(uint64(0)) +
+		2*len(c.stash)*binary.Size(uint32(0)))
+	num, err = c.rand.WriteTo(stream)
+	if err != nil {
+		return 0, err
+	}
+	return numBytes + num, nil
+}
+
+// ReadFrom reads a binary representation of CuckooFilter (such as might have
+// been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (c *CuckooFilter) ReadFrom(stream io.Reader) (int64, error) {
+	var m, b, f, v, count, n uint64
+	var semiSorted uint8
+	err := binary.Read(stream, binary.BigEndian, &m)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &b)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &f)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &v)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &count)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &n)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &semiSorted)
+	if err != nil {
+		return 0, err
+	}
+	numBytes := int64(6*binary.Size(uint64(0)) + binary.Size(uint8(0)))
+	buckets := &Buckets{}
+	num, err := buckets.ReadFrom(stream)
+	if err != nil {
+		return 0, err
+	}
+	numBytes += num
+	var values *Buckets
+	if v > 0 {
+		values = &Buckets{}
+		num, err = values.ReadFrom(stream)
+		if err != nil {
+			return 0, err
+		}
+		numBytes += num
+	}
+	var stashLen uint64
+	err = binary.Read(stream, binary.BigEndian, &stashLen)
+	if err != nil {
+		return 0, err
+	}
+	stash := make([]stashEntry, stashLen)
+	for k := range stash {
+		var i uint64
+		err = binary.Read(stream, binary.BigEndian, &i)
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Read(stream, binary.BigEndian, &stash[k].f)
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Read(stream, binary.BigEndian, &stash[k].v)
+		if err != nil {
+			return 0, err
+		}
+		stash[k].i = uint(i)
+	}
+	numBytes += int64((1+len(stash))*binary.Size(uint64(0)) +
+		2*len(stash)*binary.Size(uint32(0)))
+	num, err = c.rand.ReadFrom(stream)
+	if err != nil {
+		return 0, err
+	}
+
+	c.buckets = buckets
+	c.values = values
+	c.stash = stash
+	c.m = uint(m)
+	c.b = uint(b)
+	c.f = uint(f)
+	c.v = uint(v)
+	c.count = uint(count)
+	c.n = uint(n)
+	c.semiSorted = semiSorted == 1
+	if c.hash == nil {
+		c.hash = fnv.New32()
+	}
+	return numBytes + num, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (c *CuckooFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := c.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (c *CuckooFilter) GobDecode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := c.ReadFrom(buf)
+
+	return err
+}
+
+// calculateF returns the optimal fingerprint length in bits for the given
 // bucket size and false-positive rate epsilon.
 func calculateF(b uint, epsilon float64) uint {
+	f := math.Ceil(math.Log2(2 * float64(b) / epsilon))
+	if f < 1 {
+		return 1
+	} else if f > 32 {
+		return 32
+	}
+	return uint(f)
+}
+
+// fingerprintBytes returns the whole-byte fingerprint length which the number
+// of buckets in filters created by NewCuckooFilter is derived from.
+func fingerprintBytes(b uint, epsilon float64) uint {
 	f := uint(math.Ceil(math.Log(2 * float64(b) / epsilon)))
 	f = f / 8
 	if f <= 0 {
@@ -255,6 +859,20 @@ func calculateF(b uint, epsilon float64) uint {
 	return f
 }
 
+// cuckooMaxLoad returns the load factor up to which a filter with b entries
+// per bucket reliably accepts insertions.
+func cuckooMaxLoad(b uint) float64 {
+	switch {
+	case b >= 8:
+		return 0.95
+	case b >= 4:
+		return 0.9
+	case b >= 2:
+		return 0.75
+	}
+	return 0.5
+}
+
 // power2 calculates the next power of two for the given value.
 func power2(x uint) uint {
 	x--
@@ -267,3 +885,41 @@ func power2(x uint) uint {
 	x++
 	return x
 }
+
+// semiSortedPrefixBits is the number of bits used to encode the sorted 4-bit
+// prefixes of a semi-sorted bucket. There are 3876 non-decreasing sequences of
+// four 4-bit values, which fit in 12 bits.
+const semiSortedPrefixBits = 12
+
+// semiSortedTable maps the sorted 4-bit prefixes of a bucket's entries to
+// their 12-bit encoding and back.
+type semiSortedTable struct {
+	encode []uint16   // encoding indexed by the prefixes packed into 16 bits
+	decode [][4]uint8 // prefixes indexed by encoding
+}
+
+var (
+	semiSortedOnce   sync.Once
+	semiSortedLookup *semiSortedTable
+)
+
+// semiSortedTables returns the semi-sorted encoding tables, building them on
+// first use.
+func semiSortedTables() *semiSortedTable {
+	semiSortedOnce.Do(func() {
+		table := &semiSortedTable{encode: make([]uint16, 1<<16)}
+		for a := uint8(0); a < 16; a++ {
+			for b := a; b < 16; b++ {
+				for c := b; c < 16; c++ {
+					for d := c; d < 16; d++ {
+						key := uint16(a)<<12 | uint16(b)<<8 | uint16(c)<<4 | uint16(d)
+						table.encode[key] = uint16(len(table.decode))
+						table.decode = append(table.decode, [4]uint8{a, b, c, d})
+					}
+				}
+			}
+		}
+		semiSortedLookup = table
+	})
+	return semiSortedLookup
+}
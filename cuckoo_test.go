@@ -1,6 +1,9 @@
 package boom
 
 import (
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
 	"strconv"
 	"testing"
 )
@@ -14,6 +17,104 @@ func TestCuckooBuckets(t *testing.T) {
 	}
 }
 
+// Ensures that NewCuckooFilter picks the shortest fingerprints satisfying the
+// false-positive rate.
+func TestCuckooFingerprintBits(t *testing.T) {
+	f := NewCuckooFilter(100, 0.01)
+
+	if bits := f.FingerprintBits(); bits != 10 {
+		t.Errorf("Expected 10, got %d", bits)
+	}
+
+	if size := f.BucketSize(); size != 4 {
+		t.Errorf("Expected 4, got %d", size)
+	}
+}
+
+// Ensures that filters with custom bucket sizes and fingerprint lengths store
+// their capacity without false negatives and within the expected
+// false-positive rate.
+func TestCuckooCustom(t *testing.T) {
+	for _, b := range []uint{2, 4, 8} {
+		for _, bits := range []uint{7, 12, 16} {
+			f := NewCustomCuckooFilter(1000, b, bits)
+			for i := 0; i < 1000; i++ {
+				if err := f.Add([]byte(strconv.Itoa(i))); err != nil {
+					t.Fatalf("b=%d, f=%d: unexpected error adding %d: %v", b, bits, i, err)
+				}
+			}
+
+			for i := 0; i < 1000; i++ {
+				if !f.Test([]byte(strconv.Itoa(i))) {
+					t.Errorf("b=%d, f=%d: expected %d to be a member", b, bits, i)
+				}
+			}
+
+			fps := 0
+			for i := 1000; i < 11000; i++ {
+				if f.Test([]byte(strconv.Itoa(i))) {
+					fps++
+				}
+			}
+			expected := 2 * float64(b) / float64(uint(1)<<bits)
+			if rate := float64(fps) / 10000; rate > 2*expected {
+				t.Errorf("b=%d, f=%d: expected false-positive rate around %f, got %f",
+					b, bits, expected, rate)
+			}
+		}
+	}
+}
+
+// Ensures that the false-positive rate holds for sequential keys and keys
+// sharing a long prefix, which differ only in their last bytes.
+func TestCuckooSimilarKeys(t *testing.T) {
+	keys := map[string]func(i int) []byte{
+		"decimal": func(i int) []byte {
+			return []byte(strconv.Itoa(i))
+		},
+		"prefixed": func(i int) []byte {
+			return []byte("user:session:" + strconv.Itoa(i))
+		},
+		"binary": func(i int) []byte {
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(i))
+			return key
+		},
+	}
+
+	for name, key := range keys {
+		f := NewCuckooFilter(1000, 0.0001)
+		for i := 0; i < 1000; i++ {
+			f.Add(key(i))
+		}
+
+		fps := 0
+		for i := 1000; i < 101000; i++ {
+			if f.Test(key(i)) {
+				fps++
+			}
+		}
+
+		if rate := float64(fps) / 100000; rate > 0.0002 {
+			t.Errorf("%s keys: expected false-positive rate around 0.0001, got %f",
+				name, rate)
+		}
+	}
+}
+
+// Ensures that MemoryUsage returns the size of the packed fingerprints.
+func TestCuckooMemoryUsage(t *testing.T) {
+	f := NewCustomCuckooFilter(1000000, 4, 12)
+
+	if buckets := f.Buckets(); buckets != 524288 {
+		t.Errorf("Expected 524288, got %d", buckets)
+	}
+
+	if usage := f.MemoryUsage(); usage != 524288*4*12/8 {
+		t.Errorf("Expected %d, got %d", 524288*4*12/8, usage)
+	}
+}
+
 // Ensures that Capacity returns the expected filter capacity.
 func TestCuckooCapacity(t *testing.T) {
 	f := NewCuckooFilter(100, 0.1)
@@ -136,7 +237,7 @@ func TestCuckooReset(t *testing.T) {
 
 	for i := uint(0); i < f.m; i++ {
 		for j := uint(0); j < f.b; j++ {
-			if f.buckets[i][j] != nil {
+			if f.entry(i, j) != 0 {
 				t.Error("Expected all buckets cleared")
 			}
 		}
@@ -147,6 +248,432 @@ func TestCuckooReset(t *testing.T) {
 	}
 }
 
+// Ensures that failed insertions are held in the stash and, once the stash is
+// full, return ErrFilterFull without losing any existing items.
+func TestCuckooFull(t *testing.T) {
+	f := NewCustomCuckooFilter(4, 1, 16)
+	f.SetRandSource(NewRandSource(42))
+
+	var added []string
+	for i := 0; i < 100; i++ {
+		data := strconv.Itoa(i)
+		err := f.Add([]byte(data))
+		if err == ErrFilterFull {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		added = append(added, data)
+	}
+
+	if len(f.stash) != cuckooStashSize {
+		t.Errorf("Expected %d stashed, got %d", cuckooStashSize, len(f.stash))
+	}
+
+	if count := f.Count(); count != uint(len(added)) {
+		t.Errorf("Expected %d, got %d", len(added), count)
+	}
+
+	for _, data := range added {
+		if !f.Test([]byte(data)) {
+			t.Errorf("Expected %s to be a member", data)
+		}
+	}
+
+	// The stash is serialized along with the buckets.
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read := NewCuckooFilter(10, 0.1)
+	if _, err := read.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range added {
+		if !read.Test([]byte(data)) {
+			t.Errorf("Expected %s to be a member after serialization", data)
+		}
+	}
+
+	// A failed insertion leaves the filter unchanged.
+	data := append([]byte(nil), f.buckets.data...)
+	stash := append([]stashEntry(nil), f.stash...)
+	for i := 100; i < 200; i++ {
+		if f.Test([]byte(strconv.Itoa(i))) {
+			continue
+		}
+		if err := f.Add([]byte(strconv.Itoa(i))); err != ErrFilterFull {
+			t.Fatalf("Expected ErrFilterFull, got %v", err)
+		}
+		break
+	}
+	if !bytes.Equal(data, f.buckets.data) {
+		t.Error("Expected failed insertion to leave the buckets unchanged")
+	}
+	for i := range stash {
+		if stash[i] != f.stash[i] {
+			t.Error("Expected failed insertion to leave the stash unchanged")
+		}
+	}
+
+	// Removing items makes room for stashed ones and every item remains
+	// removable.
+	for _, data := range added {
+		if !f.TestAndRemove([]byte(data)) {
+			t.Errorf("Expected %s to be a member", data)
+		}
+	}
+
+	if count := f.Count(); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+
+	if len(f.stash) != 0 {
+		t.Errorf("Expected empty stash, got %d", len(f.stash))
+	}
+}
+
+// Ensures that the semi-sorted encoding tables round-trip every sorted
+// sequence of prefixes within 12 bits.
+func TestSemiSortedTables(t *testing.T) {
+	table := semiSortedTables()
+
+	if len(table.decode) != 3876 {
+		t.Errorf("Expected 3876, got %d", len(table.decode))
+	}
+
+	for code, prefixes := range table.decode {
+		key := uint16(prefixes[0])<<12 | uint16(prefixes[1])<<8 |
+			uint16(prefixes[2])<<4 | uint16(prefixes[3])
+		if actual := table.encode[key]; int(actual) != code {
+			t.Errorf("Expected %d, got %d", code, actual)
+		}
+	}
+}
+
+// Ensures that semi-sorted filters save a bit per entry and behave like
+// regular filters.
+func TestCuckooSemiSorted(t *testing.T) {
+	f := NewSemiSortedCuckooFilter(1000, 0.01)
+	f.SetRandSource(NewRandSource(42))
+	regular := NewCustomCuckooFilter(1000, 4, f.FingerprintBits())
+
+	if !f.SemiSorted() {
+		t.Error("Expected filter to be semi-sorted")
+	}
+
+	bits := f.FingerprintBits()
+	if expected := regular.MemoryUsage() * (bits - 1) / bits; f.MemoryUsage() != expected {
+		t.Errorf("Expected %d, got %d", expected, f.MemoryUsage())
+	}
+
+	for i := 0; i < 1000; i++ {
+		if err := f.Add([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatalf("Unexpected error adding %d: %v", i, err)
+		}
+	}
+
+	if count := f.Count(); count != 1000 {
+		t.Errorf("Expected 1000, got %d", count)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+
+	fps := 0
+	for i := 1000; i < 11000; i++ {
+		if f.Test([]byte(strconv.Itoa(i))) {
+			fps++
+		}
+	}
+	if rate := float64(fps) / 10000; rate > 0.01 {
+		t.Errorf("Expected false-positive rate at most 0.01, got %f", rate)
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read := NewCuckooFilter(10, 0.1)
+	if _, err := read.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !read.SemiSorted() {
+		t.Error("Expected read filter to be semi-sorted")
+	}
+
+	for _, filter := range []*CuckooFilter{f, read} {
+		for i := 0; i < 1000; i++ {
+			if !filter.TestAndRemove([]byte(strconv.Itoa(i))) {
+				t.Errorf("Expected %d to be a member", i)
+			}
+		}
+
+		if count := filter.Count(); count != 0 {
+			t.Errorf("Expected 0, got %d", count)
+		}
+	}
+}
+
+// Ensures that failed insertions into a full semi-sorted filter leave it
+// unchanged.
+func TestCuckooSemiSortedFull(t *testing.T) {
+	f := NewSemiSortedCuckooFilter(16, 0.01)
+	f.SetRandSource(NewRandSource(42))
+
+	var added []string
+	full := 0
+	for i := 0; i < 100; i++ {
+		data := append([]byte(nil), f.buckets.data...)
+		err := f.Add([]byte(strconv.Itoa(i)))
+		if err == ErrFilterFull {
+			full++
+			if !bytes.Equal(data, f.buckets.data) {
+				t.Error("Expected failed insertion to leave the buckets unchanged")
+			}
+			continue
+		}
+		added = append(added, strconv.Itoa(i))
+	}
+
+	if full == 0 {
+		t.Error("Expected the filter to fill up")
+	}
+
+	for _, data := range added {
+		if !f.Test([]byte(data)) {
+			t.Errorf("Expected %s to be a member", data)
+		}
+	}
+}
+
+// Ensures that filters using the same seeded source end up in identical
+// states, even when elements are relocated.
+func TestCuckooRandSource(t *testing.T) {
+	f1 := NewCuckooFilter(100, 0.1)
+	f1.SetRandSource(NewRandSource(42))
+	f2 := NewCuckooFilter(100, 0.1)
+	f2.SetRandSource(NewRandSource(42))
+	for i := 0; i < 5000; i++ {
+		f1.Add([]byte(strconv.Itoa(i)))
+		f2.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if f1.Count() != f2.Count() {
+		t.Errorf("Expected %d, got %d", f1.Count(), f2.Count())
+	}
+
+	if !bytes.Equal(f1.buckets.data, f2.buckets.data) {
+		t.Error("Expected filters with the same seed to be identical")
+	}
+}
+
+// Ensures that the filter can be serialized and resumed.
+func TestCuckooSerialization(t *testing.T) {
+	f := NewCuckooFilter(100, 0.1)
+	for i := 0; i < 50; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var buf bytes.Buffer
+	wn, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := NewCuckooFilter(10, 0.5)
+	rn, err := read.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wn != rn {
+		t.Errorf("Expected %d bytes read, got %d", wn, rn)
+	}
+
+	if count := read.Count(); count != 50 {
+		t.Errorf("Expected 50, got %d", count)
+	}
+
+	for i := 0; i < 50; i++ {
+		if !read.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+
+	if !read.TestAndRemove([]byte(`0`)) {
+		t.Error("`0` should be a member")
+	}
+}
+
+// Ensures that Fingerprints visits every stored fingerprint, including the
+// stash, and stops when asked to.
+func TestCuckooFingerprints(t *testing.T) {
+	f := NewCustomCuckooFilter(16, 2, 16)
+	f.SetRandSource(NewRandSource(42))
+	for i := 0; f.Add([]byte(strconv.Itoa(i))) == nil; i++ {
+	}
+
+	if len(f.stash) == 0 {
+		t.Error("Expected stashed fingerprints")
+	}
+
+	visited := uint(0)
+	f.Fingerprints(func(bucket uint, fingerprint uint32) bool {
+		if bucket >= f.Buckets() {
+			t.Errorf("Expected bucket less than %d, got %d", f.Buckets(), bucket)
+		}
+		if fingerprint == 0 {
+			t.Error("Expected non-zero fingerprint")
+		}
+		visited++
+		return true
+	})
+
+	if visited != f.Count() {
+		t.Errorf("Expected %d, got %d", f.Count(), visited)
+	}
+
+	visited = 0
+	f.Fingerprints(func(bucket uint, fingerprint uint32) bool {
+		visited++
+		return visited < 3
+	})
+
+	if visited != 3 {
+		t.Errorf("Expected 3, got %d", visited)
+	}
+}
+
+// Ensures that Merge adds the fingerprints of the other filter and rejects
+// filters with different parameters.
+func TestCuckooMerge(t *testing.T) {
+	f1 := NewCuckooFilter(1000, 0.001)
+	f2 := NewCuckooFilter(1000, 0.001)
+	for i := 0; i < 400; i++ {
+		f1.Add([]byte(strconv.Itoa(i)))
+		f2.Add([]byte(strconv.Itoa(i + 400)))
+	}
+
+	if overflow, err := f1.Merge(f2); err != nil || overflow != 0 {
+		t.Errorf("Expected no overflow, got %d: %v", overflow, err)
+	}
+
+	if count := f1.Count(); count != 800 {
+		t.Errorf("Expected 800, got %d", count)
+	}
+
+	for i := 0; i < 800; i++ {
+		if !f1.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+
+	for i := 400; i < 800; i++ {
+		if !f1.TestAndRemove([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be removable", i)
+		}
+	}
+
+	if _, err := f1.Merge(NewCuckooFilter(100, 0.001)); err == nil {
+		t.Error("Expected error for different number of buckets")
+	}
+
+	if _, err := f1.Merge(NewCuckooFilter(1000, 0.1)); err == nil {
+		t.Error("Expected error for different fingerprint length")
+	}
+
+	if _, err := f1.Merge(NewCustomCuckooFilter(1000, 2, f1.FingerprintBits())); err == nil {
+		t.Error("Expected error for different bucket size")
+	}
+
+	if _, err := f1.Merge(NewCuckooFilter(1000, 0.001).withValues(4)); err == nil {
+		t.Error("Expected error for different value length")
+	}
+
+	semiSorted := NewSemiSortedCuckooFilter(1000, 0.001)
+	regular := NewCustomCuckooFilter(1000, 4, semiSorted.FingerprintBits())
+	if _, err := regular.Merge(semiSorted); err == nil {
+		t.Error("Expected error for different bucket encoding")
+	}
+
+	other := NewCuckooFilter(1000, 0.001)
+	other.SetHash(fnv.New32a())
+	if _, err := f1.Merge(other); err == nil {
+		t.Error("Expected error for different hash function")
+	}
+}
+
+// Ensures that Merge reports fingerprints which don't fit.
+func TestCuckooMergeOverflow(t *testing.T) {
+	f1 := NewCustomCuckooFilter(16, 2, 16)
+	f2 := NewCustomCuckooFilter(16, 2, 16)
+	for i := 0; f1.Add([]byte(strconv.Itoa(i))) == nil; i++ {
+		f2.Add([]byte(strconv.Itoa(i + 1000)))
+	}
+	count := f1.Count()
+
+	overflow, err := f1.Merge(f2)
+	if err != ErrFilterFull {
+		t.Errorf("Expected ErrFilterFull, got %v", err)
+	}
+
+	if f1.Count()+overflow != count+f2.Count() {
+		t.Errorf("Expected %d, got %d", count+f2.Count(), f1.Count()+overflow)
+	}
+}
+
+// Ensures that Rebuild keeps every fingerprint in larger buckets, making room
+// for more elements.
+func TestCuckooRebuild(t *testing.T) {
+	for _, f := range []*CuckooFilter{
+		NewCuckooFilter(1000, 0.001),
+		NewSemiSortedCuckooFilter(1000, 0.001),
+	} {
+		f.SetRandSource(NewRandSource(42))
+		n := 0
+		for ; f.Add([]byte(strconv.Itoa(n))) == nil; n++ {
+		}
+
+		rebuilt, err := f.Rebuild(8)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rebuilt.Buckets() != f.Buckets() {
+			t.Errorf("Expected %d, got %d", f.Buckets(), rebuilt.Buckets())
+		}
+
+		if rebuilt.Capacity() != 2*f.Capacity() {
+			t.Errorf("Expected %d, got %d", 2*f.Capacity(), rebuilt.Capacity())
+		}
+
+		if rebuilt.Count() != f.Count() {
+			t.Errorf("Expected %d, got %d", f.Count(), rebuilt.Count())
+		}
+
+		for i := 0; i < n; i++ {
+			if !rebuilt.Test([]byte(strconv.Itoa(i))) {
+				t.Errorf("Expected %d to be a member", i)
+			}
+		}
+
+		for i := n; i < 2*n-100; i++ {
+			if err := rebuilt.Add([]byte(strconv.Itoa(i))); err != nil {
+				t.Fatalf("Unexpected error adding %d: %v", i, err)
+			}
+		}
+
+		if _, err := rebuilt.Rebuild(1); err != ErrFilterFull {
+			t.Errorf("Expected ErrFilterFull, got %v", err)
+		}
+	}
+}
+
 func BenchmarkCuckooAdd(b *testing.B) {
 	b.StopTimer()
 	f := NewCuckooFilter(uint(b.N), 0.1)
@@ -202,3 +729,46 @@ func BenchmarkCuckooTestAndRemove(b *testing.B) {
 		f.TestAndRemove(data[n])
 	}
 }
+
+func BenchmarkCuckooSemiSortedAdd(b *testing.B) {
+	b.StopTimer()
+	f := NewSemiSortedCuckooFilter(uint(b.N), 0.1)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
+
+func BenchmarkCuckooSemiSortedTest(b *testing.B) {
+	b.StopTimer()
+	f := NewSemiSortedCuckooFilter(uint(b.N), 0.1)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Test(data[n])
+	}
+}
+
+func BenchmarkCuckooMerge(b *testing.B) {
+	b.StopTimer()
+	f1 := NewCuckooFilter(20000, 0.001)
+	f2 := NewCuckooFilter(20000, 0.001)
+	for i := 0; i < 10000; i++ {
+		f2.Add([]byte(strconv.Itoa(i)))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f1.Reset()
+		f1.Merge(f2)
+	}
+}
@@ -0,0 +1,165 @@
+package boom
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"io"
+	"math/rand"
+)
+
+// CuckooMap implements an approximate key-value store, which stores a small
+// fixed-width value alongside each fingerprint in the buckets of a Cuckoo
+// Filter. This is useful for gating lookups into a larger store while also
+// retrieving a tag for each key, such as a shard or a version, without storing
+// the keys themselves.
+//
+// Like the Cuckoo Filter, there is a non-zero probability of false positives.
+// Get returns a value for a key which was never put if another key with the
+// same fingerprint and buckets was, and putting either key overwrites the
+// value of the other.
+type CuckooMap struct {
+	filter *CuckooFilter // fingerprints with their values
+}
+
+// NewCuckooMap creates a new Cuckoo Map optimized to store n keys with values
+// of v bits, which must be between 1 and 32, and a specified target
+// false-positive rate.
+func NewCuckooMap(n uint, v uint8, fpRate float64) *CuckooMap {
+	if v == 0 {
+		v = 1
+	}
+
+	return &CuckooMap{filter: NewCuckooFilter(n, fpRate).withValues(uint(v))}
+}
+
+// Capacity returns the number of keys the map can store.
+func (c *CuckooMap) Capacity() uint {
+	return c.filter.Capacity()
+}
+
+// Len returns the number of keys in the map.
+func (c *CuckooMap) Len() uint {
+	return c.filter.Count()
+}
+
+// ValueBits returns the width of values in bits.
+func (c *CuckooMap) ValueBits() uint {
+	return c.filter.v
+}
+
+// MemoryUsage returns the number of bytes used to store the fingerprints and
+// values.
+func (c *CuckooMap) MemoryUsage() uint {
+	return c.filter.MemoryUsage()
+}
+
+// Get returns the value for the key and true if it's in the map, or zero and
+// false if not. This is a probabilistic lookup, meaning there is a non-zero
+// probability of returning the value of another key.
+func (c *CuckooMap) Get(key []byte) (uint32, bool) {
+	i1, i2, f := c.filter.components(key)
+	for _, i := range c.filter.candidates(i1, i2) {
+		if j := c.filter.indexOf(i, f); j != -1 {
+			return c.filter.value(i, uint(j)), true
+		}
+	}
+	if idx := c.filter.stashIndexOf(i1, i2, f); idx != -1 {
+		return c.filter.stash[idx].v, true
+	}
+	return 0, false
+}
+
+// Put sets the value for the key, replacing the existing value if the key is
+// already in the map. An error is returned if the value doesn't fit in the
+// value width, or ErrFilterFull if the map is full, in which case the map is
+// left unchanged.
+func (c *CuckooMap) Put(key []byte, value uint32) error {
+	if c.filter.v < 32 && value>>c.filter.v != 0 {
+		return fmt.Errorf("value %d exceeds %d bits", value, c.filter.v)
+	}
+
+	i1, i2, f := c.filter.components(key)
+	for _, i := range c.filter.candidates(i1, i2) {
+		if j := c.filter.indexOf(i, f); j != -1 {
+			c.filter.put(i, uint(j), f, value)
+			return nil
+		}
+	}
+	if idx := c.filter.stashIndexOf(i1, i2, f); idx != -1 {
+		c.filter.stash[idx].v = value
+		return nil
+	}
+
+	return c.filter.add(i1, i2, f, value)
+}
+
+// Delete removes the key from the map. Returns true if the key was in the map,
+// false if not.
+func (c *CuckooMap) Delete(key []byte) bool {
+	return c.filter.TestAndRemove(key)
+}
+
+// Reset restores the map to its original state. It returns the map to allow
+// for chaining.
+func (c *CuckooMap) Reset() *CuckooMap {
+	c.filter.Reset()
+	return c
+}
+
+// SetHash sets the hashing function used in the map.
+// For the effect on false positive rates see: https://github.com/tylertreat/BoomFilters/pull/1
+func (c *CuckooMap) SetHash(h hash.Hash32) {
+	c.filter.SetHash(h)
+}
+
+// SetRandSource sets the source used to pick the entries to relocate when
+// inserting into full buckets, which defaults to the global math/rand source.
+// Maps using the same seeded source end up in identical states for identical
+// input. The state of a source created with NewRandSource is persisted by
+// WriteTo.
+func (c *CuckooMap) SetRandSource(src rand.Source) {
+	c.filter.SetRandSource(src)
+}
+
+// WriteTo writes a binary representation of the CuckooMap to an i/o stream.
+// It returns the number of bytes written.
+func (c *CuckooMap) WriteTo(stream io.Writer) (int64, error) {
+	return c.filter.WriteTo(stream)
+}
+
+// ReadFrom reads a binary representation of CuckooMap (such as might have been
+// written by WriteTo()) from an i/o stream. The hash function isn't persisted,
+// so the map keeps its current one. It returns the number of bytes read.
+func (c *CuckooMap) ReadFrom(stream io.Reader) (int64, error) {
+	filter := &CuckooFilter{}
+	if c.filter != nil {
+		filter.hash = c.filter.hash
+	}
+	num, err := filter.ReadFrom(stream)
+	if err != nil {
+		return 0, err
+	}
+
+	c.filter = filter
+	return num, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (c *CuckooMap) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := c.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (c *CuckooMap) GobDecode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := c.ReadFrom(buf)
+
+	return err
+}
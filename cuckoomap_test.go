@@ -0,0 +1,206 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strconv"
+	"testing"
+)
+
+// Ensures that Get returns the values set by Put.
+func TestCuckooMapPutGet(t *testing.T) {
+	m := NewCuckooMap(1000, 8, 0.0001)
+
+	if bits := m.ValueBits(); bits != 8 {
+		t.Errorf("Expected 8, got %d", bits)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if err := m.Put([]byte(strconv.Itoa(i)), uint32(i%256)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if l := m.Len(); l != 1000 {
+		t.Errorf("Expected 1000, got %d", l)
+	}
+
+	for i := 0; i < 1000; i++ {
+		value, ok := m.Get([]byte(strconv.Itoa(i)))
+		if !ok {
+			t.Errorf("Expected %d to be in the map", i)
+		}
+		if value != uint32(i%256) {
+			t.Errorf("Expected %d, got %d", i%256, value)
+		}
+	}
+
+	if _, ok := m.Get([]byte(`a`)); ok {
+		t.Error("`a` should not be in the map")
+	}
+}
+
+// Ensures that Put replaces existing values and rejects values wider than the
+// value width.
+func TestCuckooMapReplace(t *testing.T) {
+	m := NewCuckooMap(100, 4, 0.01)
+
+	if err := m.Put([]byte(`a`), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Put([]byte(`a`), 15); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _ := m.Get([]byte(`a`)); value != 15 {
+		t.Errorf("Expected 15, got %d", value)
+	}
+
+	if l := m.Len(); l != 1 {
+		t.Errorf("Expected 1, got %d", l)
+	}
+
+	if err := m.Put([]byte(`b`), 16); err == nil {
+		t.Error("Expected error for value wider than 4 bits")
+	}
+
+	if _, ok := m.Get([]byte(`b`)); ok {
+		t.Error("`b` should not be in the map")
+	}
+}
+
+// Ensures that Delete removes keys.
+func TestCuckooMapDelete(t *testing.T) {
+	m := NewCuckooMap(100, 8, 0.01)
+	m.Put([]byte(`a`), 1)
+	m.Put([]byte(`b`), 2)
+
+	if !m.Delete([]byte(`a`)) {
+		t.Error("`a` should be in the map")
+	}
+
+	if m.Delete([]byte(`a`)) {
+		t.Error("`a` should not be in the map")
+	}
+
+	if _, ok := m.Get([]byte(`a`)); ok {
+		t.Error("`a` should not be in the map")
+	}
+
+	if value, ok := m.Get([]byte(`b`)); !ok || value != 2 {
+		t.Errorf("Expected 2, got %d", value)
+	}
+
+	if m.Reset() != m {
+		t.Error("Returned CuckooMap should be the same instance")
+	}
+
+	if l := m.Len(); l != 0 {
+		t.Errorf("Expected 0, got %d", l)
+	}
+}
+
+// Ensures that values are kept with their keys when the map is full and
+// entries are relocated or stashed.
+func TestCuckooMapFull(t *testing.T) {
+	m := NewCuckooMap(16, 16, 0.000001)
+	m.SetRandSource(NewRandSource(42))
+
+	values := map[string]uint32{}
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		err := m.Put([]byte(key), uint32(i*7))
+		if err == ErrFilterFull {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		values[key] = uint32(i * 7)
+	}
+
+	if len(m.filter.stash) == 0 {
+		t.Error("Expected stashed entries")
+	}
+
+	for key, expected := range values {
+		if value, ok := m.Get([]byte(key)); !ok || value != expected {
+			t.Errorf("Expected %d for %s, got %d", expected, key, value)
+		}
+	}
+}
+
+// Ensures that the map can be serialized and resumed.
+func TestCuckooMapSerialization(t *testing.T) {
+	m := NewCuckooMap(1000, 12, 0.001)
+	for i := 0; i < 500; i++ {
+		m.Put([]byte(strconv.Itoa(i)), uint32(i))
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &CuckooMap{}
+	if err := gob.NewDecoder(&buf).Decode(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	wn, err := m.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := NewCuckooMap(10, 1, 0.1)
+	rn, err := read.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wn != rn {
+		t.Errorf("Expected %d bytes read, got %d", wn, rn)
+	}
+
+	for _, restored := range []*CuckooMap{decoded, read} {
+		if bits := restored.ValueBits(); bits != 12 {
+			t.Errorf("Expected 12, got %d", bits)
+		}
+
+		for i := 0; i < 500; i++ {
+			key := []byte(strconv.Itoa(i))
+			expected, _ := m.Get(key)
+			if value, ok := restored.Get(key); !ok || value != expected {
+				t.Errorf("Expected %d, got %d", expected, value)
+			}
+		}
+	}
+}
+
+func BenchmarkCuckooMapPut(b *testing.B) {
+	b.StopTimer()
+	m := NewCuckooMap(uint(b.N), 8, 0.01)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		m.Put(data[n], uint32(n%256))
+	}
+}
+
+func BenchmarkCuckooMapGet(b *testing.B) {
+	b.StopTimer()
+	m := NewCuckooMap(uint(b.N), 8, 0.01)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		m.Get(data[n])
+	}
+}
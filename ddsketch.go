@@ -0,0 +1,446 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// minNormalFloat64 is the smallest positive normal float64.
+const minNormalFloat64 = 0x1p-1022
+
+// defaultDDSketchAccuracy is the relative accuracy used when an invalid one is
+// given to NewDDSketch.
+const defaultDDSketchAccuracy = 0.01
+
+// ddStore is a dense array of bin counts indexed from offset. When the range
+// of indices exceeds maxBins, the lowest bins are collapsed into one, or the
+// highest bins if collapseHighest is set.
+type ddStore struct {
+	bins            []uint64 // bin counts
+	offset          int      // index of the first bin
+	count           uint64   // total count across bins
+	maxBins         int      // maximum number of bins
+	collapseHighest bool     // whether the highest bins are collapsed
+}
+
+// add increments the bin for the given index by n.
+func (d *ddStore) add(index int, n uint64) {
+	if len(d.bins) == 0 {
+		d.bins = []uint64{0}
+		d.offset = index
+	}
+
+	var (
+		lo = d.offset
+		hi = d.offset + len(d.bins) - 1
+	)
+	if index < lo {
+		lo = index
+	}
+	if index > hi {
+		hi = index
+	}
+	if hi-lo+1 > d.maxBins {
+		if d.collapseHighest {
+			hi = lo + d.maxBins - 1
+		} else {
+			lo = hi - d.maxBins + 1
+		}
+	}
+	if index < lo {
+		index = lo
+	} else if index > hi {
+		index = hi
+	}
+	if lo != d.offset || hi != d.offset+len(d.bins)-1 {
+		d.resize(lo, hi)
+	}
+
+	d.bins[index-d.offset] += n
+	d.count += n
+}
+
+// resize reallocates the bins to cover the indices from lo to hi. Bins below
+// lo are collapsed into the lowest bin and bins above hi into the highest.
+func (d *ddStore) resize(lo, hi int) {
+	bins := make([]uint64, hi-lo+1)
+	for i, n := range d.bins {
+		index := d.offset + i
+		if index < lo {
+			index = lo
+		} else if index > hi {
+			index = hi
+		}
+		bins[index-lo] += n
+	}
+	d.bins = bins
+	d.offset = lo
+}
+
+// keyAtRank returns the index of the bin containing the value with the given
+// zero-based rank.
+func (d *ddStore) keyAtRank(rank float64) int {
+	cumulative := uint64(0)
+	for i, n := range d.bins {
+		cumulative += n
+		if float64(cumulative) > rank {
+			return d.offset + i
+		}
+	}
+	return d.offset + len(d.bins) - 1
+}
+
+// merge adds the bin counts of another store.
+func (d *ddStore) merge(other *ddStore) {
+	for i, n := range other.bins {
+		if n > 0 {
+			d.add(other.offset+i, n)
+		}
+	}
+}
+
+// reset removes all bins.
+func (d *ddStore) reset() {
+	d.bins = nil
+	d.offset = 0
+	d.count = 0
+}
+
+// writeTo writes a binary representation of the store to an i/o stream.
+func (d *ddStore) writeTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, int64(d.offset))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(len(d.bins)))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, d.bins)
+	if err != nil {
+		return 0, err
+	}
+	return int64((2 + len(d.bins)) * binary.Size(uint64(0))), nil
+}
+
+// readFrom reads a binary representation of the store from an i/o stream.
+func (d *ddStore) readFrom(stream io.Reader) (int64, error) {
+	var offset int64
+	var len uint64
+	err := binary.Read(stream, binary.BigEndian, &offset)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &len)
+	if err != nil {
+		return 0, err
+	}
+	bins := make([]uint64, len)
+	err = binary.Read(stream, binary.BigEndian, bins)
+	if err != nil {
+		return 0, err
+	}
+
+	d.offset = int(offset)
+	d.bins = bins
+	d.count = 0
+	for _, n := range bins {
+		d.count += n
+	}
+	return int64((2 + len) * uint64(binary.Size(uint64(0)))), nil
+}
+
+// DDSketch implements a quantile sketch with relative-error guarantees as
+// described by Masson, Rim, and Lee in DDSketch: A Fast and Fully-Mergeable
+// Quantile Sketch with Relative-Error Guarantees:
+//
+// http://www.vldb.org/pvldb/vol12/p2195-masson.pdf
+//
+// A DDSketch maps values to bins using a logarithmic index so that every value
+// in a bin is within a relative accuracy, alpha, of the bin's representative
+// value. Positive and negative values are counted in separate stores while
+// values close to zero are counted separately. Quantiles are answered by
+// walking the bins in order, so any quantile is returned within a relative
+// error of alpha. Memory is bounded by collapsing bins once the number of bins
+// exceeds a limit. The positive store collapses its lowest indices, the
+// smallest magnitudes, while the negative store collapses its highest, the
+// largest magnitudes, so only the lowest quantiles are affected.
+//
+// Since the bins are determined only by alpha, sketches built on separate
+// hosts merge exactly by adding their bin counts. For rank-error guarantees,
+// refer to the KLL sketch.
+type DDSketch struct {
+	positive     *ddStore // bins for positive values
+	negative     *ddStore // bins for the magnitude of negative values
+	zeroCount    uint64   // number of values indistinguishable from zero
+	alpha        float64  // relative accuracy
+	gamma        float64  // bin growth factor
+	multiplier   float64  // inverse logarithm of gamma
+	minIndexable float64  // smallest magnitude not counted as zero
+	maxBins      uint     // maximum number of bins per store
+	min          float64  // minimum value added
+	max          float64  // maximum value added
+}
+
+// NewDDSketch creates a new DDSketch which returns quantiles within the given
+// relative accuracy and keeps at most maxBins bins for each of the positive
+// and negative values. The relative accuracy must be between 0 and 1,
+// exclusive, otherwise the default of 0.01 is used.
+func NewDDSketch(relativeAccuracy float64, maxBins uint) *DDSketch {
+	if !(relativeAccuracy > 0 && relativeAccuracy < 1) {
+		relativeAccuracy = defaultDDSketchAccuracy
+	}
+
+	var (
+		gamma      = (1 + relativeAccuracy) / (1 - relativeAccuracy)
+		multiplier = 1 / math.Log(gamma)
+	)
+	if maxBins == 0 {
+		maxBins = 1
+	}
+
+	return &DDSketch{
+		positive:   &ddStore{maxBins: int(maxBins)},
+		negative:   &ddStore{maxBins: int(maxBins), collapseHighest: true},
+		alpha:      relativeAccuracy,
+		gamma:      gamma,
+		multiplier: multiplier,
+		minIndexable: math.Max(math.Exp(float64(math.MinInt32+1)/multiplier),
+			minNormalFloat64*gamma),
+		maxBins: maxBins,
+		min:     math.Inf(1),
+		max:     math.Inf(-1),
+	}
+}
+
+// NewDefaultDDSketch creates a new DDSketch which returns quantiles within the
+// given relative accuracy and keeps at most 2048 bins for each of the positive
+// and negative values. With 1% relative accuracy, this covers values spanning
+// more than 17 orders of magnitude before collapsing.
+func NewDefaultDDSketch(relativeAccuracy float64) *DDSketch {
+	return NewDDSketch(relativeAccuracy, 2048)
+}
+
+// RelativeAccuracy returns the relative accuracy, alpha.
+func (d *DDSketch) RelativeAccuracy() float64 {
+	return d.alpha
+}
+
+// Count returns the number of values added to the sketch.
+func (d *DDSketch) Count() uint64 {
+	return d.positive.count + d.negative.count + d.zeroCount
+}
+
+// Min returns the minimum value added to the sketch.
+func (d *DDSketch) Min() float64 {
+	return d.min
+}
+
+// Max returns the maximum value added to the sketch.
+func (d *DDSketch) Max() float64 {
+	return d.max
+}
+
+// Add will add the value to the sketch. Returns the DDSketch to allow for
+// chaining.
+func (d *DDSketch) Add(value float64) *DDSketch {
+	return d.AddN(value, 1)
+}
+
+// AddN will add the value to the sketch n times. NaN and infinite values are
+// ignored. Returns the DDSketch to allow for chaining.
+func (d *DDSketch) AddN(value float64, n uint64) *DDSketch {
+	if math.IsNaN(value) || math.IsInf(value, 0) || n == 0 {
+		return d
+	}
+
+	switch {
+	case value > d.minIndexable:
+		d.positive.add(d.index(value), n)
+	case value < -d.minIndexable:
+		d.negative.add(d.index(-value), n)
+	default:
+		d.zeroCount += n
+	}
+
+	if value < d.min {
+		d.min = value
+	}
+	if value > d.max {
+		d.max = value
+	}
+	return d
+}
+
+// Quantile returns the approximate value at the given quantile, q, which must
+// be between 0 and 1. The result is within the relative accuracy of the true
+// value unless the bins have been collapsed. Returns NaN if the sketch is
+// empty.
+func (d *DDSketch) Quantile(q float64) float64 {
+	count := d.Count()
+	if count == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	if q == 0 {
+		return d.min
+	}
+	if q == 1 {
+		return d.max
+	}
+
+	var (
+		rank     = q * float64(count-1)
+		negative = float64(d.negative.count)
+		quantile float64
+	)
+	switch {
+	case rank < negative:
+		quantile = -d.value(d.negative.keyAtRank(negative - 1 - rank))
+	case rank < negative+float64(d.zeroCount):
+		quantile = 0
+	default:
+		quantile = d.value(d.positive.keyAtRank(rank - negative - float64(d.zeroCount)))
+	}
+
+	// The representative value of a bin may lie outside the observed range.
+	return math.Max(math.Min(quantile, d.max), d.min)
+}
+
+// Merge combines this DDSketch with another. The other sketch is not modified.
+// Returns an error if the relative accuracy doesn't match.
+func (d *DDSketch) Merge(other *DDSketch) error {
+	if d.gamma != other.gamma {
+		return errors.New("relative accuracy must match")
+	}
+
+	d.positive.merge(other.positive)
+	d.negative.merge(other.negative)
+	d.zeroCount += other.zeroCount
+	if other.min < d.min {
+		d.min = other.min
+	}
+	if other.max > d.max {
+		d.max = other.max
+	}
+	return nil
+}
+
+// Reset restores the DDSketch to its original state. It returns itself to
+// allow for chaining.
+func (d *DDSketch) Reset() *DDSketch {
+	d.positive.reset()
+	d.negative.reset()
+	d.zeroCount = 0
+	d.min = math.Inf(1)
+	d.max = math.Inf(-1)
+	return d
+}
+
+// index returns the bin index for the given positive value.
+func (d *DDSketch) index(value float64) int {
+	return int(math.Ceil(math.Log(value) * d.multiplier))
+}
+
+// value returns the representative value for the given bin index, which is
+// within the relative accuracy of every value in the bin.
+func (d *DDSketch) value(index int) float64 {
+	return math.Pow(d.gamma, float64(index)) * 2 / (1 + d.gamma)
+}
+
+// WriteTo writes a binary representation of the DDSketch to an i/o stream.
+// It returns the number of bytes written.
+func (d *DDSketch) WriteTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, d.alpha)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(d.maxBins))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, d.min)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, d.max)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, d.zeroCount)
+	if err != nil {
+		return 0, err
+	}
+	positive, err := d.positive.writeTo(stream)
+	if err != nil {
+		return 0, err
+	}
+	negative, err := d.negative.writeTo(stream)
+	if err != nil {
+		return 0, err
+	}
+	return positive + negative + int64(5*binary.Size(uint64(0))), nil
+}
+
+// ReadFrom reads a binary representation of DDSketch (such as might have been
+// written by WriteTo()) from an i/o stream. It returns the number of bytes
+// read.
+func (d *DDSketch) ReadFrom(stream io.Reader) (int64, error) {
+	var alpha, min, max float64
+	var maxBins, zeroCount uint64
+	err := binary.Read(stream, binary.BigEndian, &alpha)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &maxBins)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &min)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &max)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &zeroCount)
+	if err != nil {
+		return 0, err
+	}
+
+	*d = *NewDDSketch(alpha, uint(maxBins))
+	positive, err := d.positive.readFrom(stream)
+	if err != nil {
+		return 0, err
+	}
+	negative, err := d.negative.readFrom(stream)
+	if err != nil {
+		return 0, err
+	}
+	d.min = min
+	d.max = max
+	d.zeroCount = zeroCount
+	return positive + negative + int64(5*binary.Size(uint64(0))), nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (d *DDSketch) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := d.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (d *DDSketch) GobDecode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := d.ReadFrom(buf)
+
+	return err
+}
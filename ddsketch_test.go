@@ -0,0 +1,210 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// Ensures that Quantile returns values within the relative accuracy.
+func TestDDSketchQuantile(t *testing.T) {
+	var (
+		d      = NewDefaultDDSketch(0.01)
+		r      = rand.New(rand.NewSource(1))
+		values = make([]float64, 10000)
+	)
+	for i := range values {
+		values[i] = r.ExpFloat64() * 100
+		if d.Add(values[i]) != d {
+			t.Fatal("Returned DDSketch should be the same instance")
+		}
+	}
+	sort.Float64s(values)
+
+	if count := d.Count(); count != 10000 {
+		t.Errorf("expected 10000, got %d", count)
+	}
+
+	for _, q := range []float64{0.01, 0.1, 0.5, 0.9, 0.99, 0.999} {
+		expected := values[int(q*float64(len(values)-1))]
+		if actual := d.Quantile(q); math.Abs(actual-expected) > 0.01*expected {
+			t.Errorf("expected %f within 1%%, got %f", expected, actual)
+		}
+	}
+
+	if min, max := d.Quantile(0), d.Quantile(1); min != values[0] || max != values[len(values)-1] {
+		t.Errorf("expected %f and %f, got %f and %f", values[0], values[len(values)-1], min, max)
+	}
+}
+
+// Ensures that negative values and zero are accounted for.
+func TestDDSketchNegativeAndZero(t *testing.T) {
+	d := NewDefaultDDSketch(0.01)
+	if !math.IsNaN(d.Quantile(0.5)) {
+		t.Error("expected NaN for empty sketch")
+	}
+
+	for i := -100; i <= 100; i++ {
+		d.Add(float64(i))
+	}
+	d.Add(math.NaN()).Add(math.Inf(1))
+
+	if count := d.Count(); count != 201 {
+		t.Errorf("expected 201, got %d", count)
+	}
+
+	if median := d.Quantile(0.5); median != 0 {
+		t.Errorf("expected 0, got %f", median)
+	}
+
+	if q := d.Quantile(0.1); math.Abs(q+80) > 0.8 {
+		t.Errorf("expected about -80, got %f", q)
+	}
+
+	if q := d.Quantile(0.9); math.Abs(q-80) > 0.8 {
+		t.Errorf("expected about 80, got %f", q)
+	}
+}
+
+// Ensures that the number of bins is bounded by collapsing the lowest bins.
+func TestDDSketchCollapse(t *testing.T) {
+	d := NewDDSketch(0.01, 100)
+	for i := 0; i < 1000; i++ {
+		d.AddN(math.Pow(1.1, float64(i)), 2)
+	}
+
+	if bins := len(d.positive.bins); bins != 100 {
+		t.Errorf("expected 100 bins, got %d", bins)
+	}
+
+	if count := d.Count(); count != 2000 {
+		t.Errorf("expected 2000, got %d", count)
+	}
+
+	expected := math.Pow(1.1, 989)
+	if q := d.Quantile(0.99); math.Abs(q-expected) > 0.01*expected {
+		t.Errorf("expected %g within 1%%, got %g", expected, q)
+	}
+}
+
+// Ensures that the negative store collapses its largest magnitudes, so only
+// the lowest quantiles are affected.
+func TestDDSketchCollapseNegative(t *testing.T) {
+	d := NewDDSketch(0.01, 100)
+	for i := 0; i < 1000; i++ {
+		d.AddN(-math.Pow(1.1, float64(i)), 2)
+	}
+
+	if bins := len(d.negative.bins); bins != 100 {
+		t.Errorf("expected 100 bins, got %d", bins)
+	}
+
+	expected := -math.Pow(1.1, 9)
+	if q := d.Quantile(0.99); math.Abs(q-expected) > -0.01*expected {
+		t.Errorf("expected %g within 1%%, got %g", expected, q)
+	}
+}
+
+// Ensures that NewDDSketch replaces relative accuracies outside of (0, 1).
+func TestDDSketchRelativeAccuracy(t *testing.T) {
+	for _, alpha := range []float64{0, -0.5, 1, 2, math.NaN()} {
+		d := NewDDSketch(alpha, 100)
+		if accuracy := d.RelativeAccuracy(); accuracy != 0.01 {
+			t.Errorf("expected 0.01 for %f, got %f", alpha, accuracy)
+		}
+
+		d.Add(100)
+		if q := d.Quantile(0.5); math.Abs(q-100) > 1 {
+			t.Errorf("expected about 100, got %f", q)
+		}
+	}
+}
+
+// Ensures that Merge combines the sketches exactly.
+func TestDDSketchMerge(t *testing.T) {
+	var (
+		merged = NewDefaultDDSketch(0.01)
+		all    = NewDefaultDDSketch(0.01)
+	)
+	for i := 0; i < 10; i++ {
+		d := NewDefaultDDSketch(0.01)
+		for j := 0; j < 1000; j++ {
+			d.Add(float64(i*1000 + j - 5000))
+			all.Add(float64(i*1000 + j - 5000))
+		}
+		if err := merged.Merge(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, q := range []float64{0, 0.01, 0.25, 0.5, 0.75, 0.99, 1} {
+		if expected, actual := all.Quantile(q), merged.Quantile(q); expected != actual {
+			t.Errorf("expected %f, got %f", expected, actual)
+		}
+	}
+
+	if err := merged.Merge(NewDefaultDDSketch(0.02)); err == nil {
+		t.Error("expected error for mismatched relative accuracy")
+	}
+}
+
+// Ensures that Reset restores the sketch to its original state.
+func TestDDSketchReset(t *testing.T) {
+	d := NewDefaultDDSketch(0.01)
+	for i := 0; i < 1000; i++ {
+		d.Add(float64(i))
+	}
+
+	if d.Reset() != d {
+		t.Error("Returned DDSketch should be the same instance")
+	}
+
+	if count := d.Count(); count != 0 {
+		t.Errorf("expected 0, got %d", count)
+	}
+}
+
+// Ensures that DDSketch can be serialized and deserialized without errors.
+func TestDDSketchSerialization(t *testing.T) {
+	d := NewDefaultDDSketch(0.01)
+	for i := -1000; i < 10000; i++ {
+		d.Add(float64(i))
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(d); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &DDSketch{}
+	if err := gob.NewDecoder(&buf).Decode(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, q := range []float64{0, 0.01, 0.5, 0.99, 1} {
+		if expected, actual := d.Quantile(q), decoded.Quantile(q); expected != actual {
+			t.Errorf("expected %f, got %f", expected, actual)
+		}
+	}
+
+	if err := decoded.Merge(d); err != nil {
+		t.Error(err)
+	}
+
+	if count := decoded.Count(); count != 22000 {
+		t.Errorf("expected 22000, got %d", count)
+	}
+}
+
+func BenchmarkDDSketchAdd(b *testing.B) {
+	d := NewDefaultDDSketch(0.01)
+	r := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		d.Add(r.ExpFloat64())
+	}
+}
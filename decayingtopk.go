@@ -0,0 +1,213 @@
+package boom
+
+import (
+	"hash"
+	"hash/fnv"
+	"math"
+	"time"
+)
+
+// decayingTopKRenormalize is the number of half-lives after which the forward
+// decay landmark is advanced to keep the weights within floating-point range.
+const decayingTopKRenormalize = 64
+
+// DecayingTopK calculates the top-k trending elements in a stream. It's like
+// TopK, but the counts decay exponentially over time with a configurable
+// half-life, so elements which were frequent in the past but are no longer
+// seen leave the top-k.
+//
+// Decay is implemented using forward decay as described by Cormode, Shkapenyuk,
+// Srivastava, and Xu in Forward Decay: A Practical Time Decay Model for
+// Streaming Systems:
+//
+// http://dimacs.rutgers.edu/~graham/pubs/papers/fwddecay.pdf
+//
+// Rather than decaying every counter as time passes, each item is weighted by
+// 2^((t - L) / halfLife), where L is a landmark time, and the weighted counts
+// are kept in a Count-Min Sketch. Dividing a count by the current weight
+// yields its decayed value. Since all counts decay at the same rate, the
+// relative order of the top-k elements is preserved without updating them.
+// The landmark is periodically advanced to keep the weights within range.
+type DecayingTopK struct {
+	matrix   [][]float64      // weighted count matrix
+	width    uint             // matrix width
+	depth    uint             // matrix depth
+	k        uint             // number of top elements
+	halfLife time.Duration    // time for a count to decay by half
+	landmark time.Time        // forward decay landmark
+	elements *indexedHeap     // top-k elements
+	clock    func() time.Time // current time
+	hash     hash.Hash64      // hash function (kernel for all depth functions)
+}
+
+// NewDecayingTopK creates a new DecayingTopK backed by a Count-Min Sketch
+// whose relative accuracy is within a factor of epsilon with probability
+// delta. It tracks the k most frequent elements, whose counts decay by half
+// every halfLife. K is at least 1 and the half-life is at least one
+// nanosecond.
+func NewDecayingTopK(epsilon, delta float64, k uint, halfLife time.Duration) *DecayingTopK {
+	if k == 0 {
+		k = 1
+	}
+	if halfLife <= 0 {
+		halfLife = time.Nanosecond
+	}
+
+	var (
+		width, depth = cmsDimensions(epsilon, delta)
+		matrix       = make([][]float64, depth)
+	)
+
+	for i := uint(0); i < depth; i++ {
+		matrix[i] = make([]float64, width)
+	}
+
+	d := &DecayingTopK{
+		matrix:   matrix,
+		width:    width,
+		depth:    depth,
+		k:        k,
+		halfLife: halfLife,
+		clock:    time.Now,
+		hash:     fnv.New64(),
+	}
+	d.Reset()
+	return d
+}
+
+// HalfLife returns the time for a count to decay by half.
+func (d *DecayingTopK) HalfLife() time.Duration {
+	return d.halfLife
+}
+
+// Add will add the data to the DecayingTopK and update the top-k heap if
+// applicable. Returns the DecayingTopK to allow for chaining.
+func (d *DecayingTopK) Add(data []byte) *DecayingTopK {
+	return d.AddN(data, 1)
+}
+
+// AddN will add the data to the DecayingTopK n times and update the top-k
+// heap if applicable. Returns the DecayingTopK to allow for chaining.
+func (d *DecayingTopK) AddN(data []byte, n uint64) *DecayingTopK {
+	now := d.clock()
+	if now.Sub(d.landmark) > decayingTopKRenormalize*d.halfLife {
+		d.renormalize(now)
+	}
+	weight := d.weight(now)
+
+	var (
+		lower, upper = hashKernel(data, d.hash)
+		score        = math.Inf(1)
+	)
+
+	for i := uint(0); i < d.depth; i++ {
+		cell := &d.matrix[i][cmsColumn(lower, upper, i, d.width)]
+		*cell += float64(n) * weight
+		score = math.Min(score, *cell)
+	}
+
+	if d.isTop(score) {
+		d.insert(data, score)
+	}
+
+	return d
+}
+
+// Count returns the approximate decayed count of the data as of now.
+func (d *DecayingTopK) Count(data []byte) float64 {
+	var (
+		lower, upper = hashKernel(data, d.hash)
+		score        = math.Inf(1)
+	)
+
+	for i := uint(0); i < d.depth; i++ {
+		score = math.Min(score, d.matrix[i][cmsColumn(lower, upper, i, d.width)])
+	}
+
+	return score / d.weight(d.clock())
+}
+
+// Elements returns the top-k elements from lowest to highest decayed
+// frequency as of now. Frequencies are rounded to the nearest integer.
+func (d *DecayingTopK) Elements() []*Element {
+	var (
+		weight = d.weight(d.clock())
+		topK   = make([]*Element, 0, d.elements.Len())
+	)
+
+	for _, element := range d.elements.sorted() {
+		topK = append(topK, &Element{
+			Data: element.Data,
+			Freq: uint64(math.Round(element.score / weight)),
+		})
+	}
+
+	return topK
+}
+
+// Reset restores the DecayingTopK to its original state. It returns itself to
+// allow for chaining.
+func (d *DecayingTopK) Reset() *DecayingTopK {
+	for i := range d.matrix {
+		for j := range d.matrix[i] {
+			d.matrix[i][j] = 0
+		}
+	}
+	d.landmark = d.clock()
+	d.elements = newIndexedHeap(d.k)
+	return d
+}
+
+// SetClock sets the function used to get the current time, which defaults to
+// time.Now. Since the decay is measured from the clock's current time, it
+// should be set before any data is added.
+func (d *DecayingTopK) SetClock(clock func() time.Time) {
+	d.clock = clock
+	d.landmark = clock()
+}
+
+// SetHash sets the hashing function used.
+func (d *DecayingTopK) SetHash(h hash.Hash64) {
+	d.hash = h
+}
+
+// weight returns the forward decay weight of an item seen at the given time.
+func (d *DecayingTopK) weight(now time.Time) float64 {
+	return math.Exp2(float64(now.Sub(d.landmark)) / float64(d.halfLife))
+}
+
+// renormalize advances the landmark to the given time, scaling the counts and
+// scores accordingly.
+func (d *DecayingTopK) renormalize(now time.Time) {
+	weight := d.weight(now)
+	for i := range d.matrix {
+		for j := range d.matrix[i] {
+			d.matrix[i][j] /= weight
+		}
+	}
+	for _, element := range d.elements.elements {
+		element.score /= weight
+	}
+	d.landmark = now
+}
+
+// isTop indicates if the given score falls within the top-k heap.
+func (d *DecayingTopK) isTop(score float64) bool {
+	if d.elements.Len() < int(d.k) {
+		return true
+	}
+
+	return score >= d.elements.min().score
+}
+
+// insert adds the data to the top-k heap. If the data is already an element,
+// the score is updated. If the heap already has k elements, the element with
+// the minimum score is removed.
+func (d *DecayingTopK) insert(data []byte, score float64) {
+	if _, ok := d.elements.index[string(data)]; !ok {
+		// The data is copied since the caller may reuse it.
+		data = append([]byte(nil), data...)
+	}
+
+	d.elements.updateScore(data, 0, score, d.k)
+}
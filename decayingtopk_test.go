@@ -0,0 +1,204 @@
+package boom
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testClock is a manually advanced clock for testing time-dependent
+// structures.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Unix(1500000000, 0)}
+}
+
+// newTestDecayingTopK creates a DecayingTopK using the given test clock.
+func newTestDecayingTopK(clock *testClock, k uint, halfLife time.Duration) *DecayingTopK {
+	d := NewDecayingTopK(0.001, 0.99, k, halfLife)
+	d.SetClock(clock.Now)
+	return d
+}
+
+// Ensures that DecayingTopK returns the top-k most frequent elements when no
+// time has passed.
+func TestDecayingTopK(t *testing.T) {
+	clock := newTestClock()
+	d := newTestDecayingTopK(clock, 3, time.Minute)
+
+	d.AddN([]byte(`bob`), 3)
+	d.AddN([]byte(`tyler`), 5)
+	d.Add([]byte(`fred`))
+	d.AddN([]byte(`alice`), 4)
+
+	if d.Add([]byte(`fred`)) != d {
+		t.Error("Returned DecayingTopK should be the same instance")
+	}
+
+	expected := []struct {
+		name string
+		freq uint64
+	}{
+		{"bob", 3},
+		{"alice", 4},
+		{"tyler", 5},
+	}
+
+	actual := d.Elements()
+	if l := len(actual); l != 3 {
+		t.Fatalf("expected len 3, got %d", l)
+	}
+
+	for i, element := range actual {
+		if e := string(element.Data); e != expected[i].name {
+			t.Errorf("expected %s, got %s", expected[i].name, e)
+		}
+		if freq := element.Freq; freq != expected[i].freq {
+			t.Errorf("expected %d, got %d", expected[i].freq, freq)
+		}
+	}
+
+	if count := d.Count([]byte(`fred`)); count != 2 {
+		t.Errorf("expected 2, got %f", count)
+	}
+
+	if d.Reset() != d {
+		t.Error("Returned DecayingTopK should be the same instance")
+	}
+
+	if l := len(d.Elements()); l != 0 {
+		t.Errorf("expected 0, got %d", l)
+	}
+}
+
+// Ensures that counts decay by half every half-life so that recent elements
+// displace elements which are no longer seen.
+func TestDecayingTopKDecay(t *testing.T) {
+	clock := newTestClock()
+	d := newTestDecayingTopK(clock, 2, time.Minute)
+
+	d.AddN([]byte(`old`), 100)
+	d.AddN([]byte(`older`), 80)
+
+	clock.Advance(time.Minute)
+	if count := d.Count([]byte(`old`)); math.Abs(count-50) > 1e-9 {
+		t.Errorf("expected 50, got %f", count)
+	}
+
+	clock.Advance(9 * time.Minute)
+	d.AddN([]byte(`new`), 10)
+
+	actual := d.Elements()
+	if l := len(actual); l != 2 {
+		t.Fatalf("expected len 2, got %d", l)
+	}
+
+	if e := string(actual[0].Data); e != "old" {
+		t.Errorf("expected old, got %s", e)
+	}
+	if freq := actual[0].Freq; freq != 0 {
+		t.Errorf("expected 0, got %d", freq)
+	}
+	if e := string(actual[1].Data); e != "new" {
+		t.Errorf("expected new, got %s", e)
+	}
+	if freq := actual[1].Freq; freq != 10 {
+		t.Errorf("expected 10, got %d", freq)
+	}
+}
+
+// Ensures that counts remain accurate after the landmark is advanced.
+func TestDecayingTopKRenormalize(t *testing.T) {
+	clock := newTestClock()
+	d := newTestDecayingTopK(clock, 2, time.Second)
+
+	for i := 0; i < 10; i++ {
+		clock.Advance(50 * time.Second)
+		d.AddN([]byte(`bob`), 8)
+		clock.Advance(time.Second)
+		d.AddN([]byte(`alice`), 8)
+	}
+
+	clock.Advance(time.Second)
+	if count := d.Count([]byte(`bob`)); math.Abs(count-2) > 1e-6 {
+		t.Errorf("expected 2, got %f", count)
+	}
+	if count := d.Count([]byte(`alice`)); math.Abs(count-4) > 1e-6 {
+		t.Errorf("expected 4, got %f", count)
+	}
+
+	actual := d.Elements()
+	if l := len(actual); l != 2 {
+		t.Fatalf("expected len 2, got %d", l)
+	}
+	if e := string(actual[1].Data); e != "alice" {
+		t.Errorf("expected alice, got %s", e)
+	}
+}
+
+// Ensures that non-positive half-lives are raised to a nanosecond, so counts
+// stay finite and decay almost immediately.
+func TestDecayingTopKHalfLife(t *testing.T) {
+	for _, halfLife := range []time.Duration{0, -time.Minute} {
+		clock := newTestClock()
+		d := newTestDecayingTopK(clock, 3, halfLife)
+		if h := d.HalfLife(); h != time.Nanosecond {
+			t.Errorf("expected 1ns, got %s", h)
+		}
+
+		d.Add([]byte(`bob`)).Add([]byte(`bob`))
+		if count := d.Count([]byte(`bob`)); math.Abs(count-2) > 1e-9 {
+			t.Errorf("expected 2, got %f", count)
+		}
+
+		clock.Advance(time.Second)
+		d.Add([]byte(`alice`))
+		if count := d.Count([]byte(`bob`)); count != 0 {
+			t.Errorf("expected 0, got %f", count)
+		}
+		if count := d.Count([]byte(`alice`)); math.Abs(count-1) > 1e-9 {
+			t.Errorf("expected 1, got %f", count)
+		}
+	}
+}
+
+// Ensures that k is at least 1.
+func TestDecayingTopKZeroK(t *testing.T) {
+	clock := newTestClock()
+	d := newTestDecayingTopK(clock, 0, time.Minute)
+	d.Add([]byte(`bob`)).Add([]byte(`alice`)).Add([]byte(`alice`))
+
+	actual := d.Elements()
+	if l := len(actual); l != 1 {
+		t.Fatalf("expected len 1, got %d", l)
+	}
+	if e := string(actual[0].Data); e != "alice" {
+		t.Errorf("expected alice, got %s", e)
+	}
+}
+
+func BenchmarkDecayingTopKAdd(b *testing.B) {
+	b.StopTimer()
+	d := NewDecayingTopK(0.001, 0.99, 5, time.Minute)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		d.Add(data[n])
+	}
+}
@@ -0,0 +1,336 @@
+package boom
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand"
+)
+
+// defaultHeavyKeeperDecay is the exponential decay base used by
+// NewDefaultHeavyKeeper, as recommended by the HeavyKeeper paper.
+const defaultHeavyKeeperDecay = 1.08
+
+// hkBucket is a HeavyKeeper bucket holding a fingerprint and its count.
+type hkBucket struct {
+	fingerprint uint32
+	count       uint64
+}
+
+// HeavyKeeper implements the HeavyKeeper top-k algorithm as described by Gong,
+// Yang, Zhang, Li, Uhlig, Chen, Uden, and Li in HeavyKeeper: An Accurate
+// Algorithm for Finding Top-k Elephant Flows:
+//
+// https://www.usenix.org/system/files/conference/atc18/atc18-gong.pdf
+//
+// HeavyKeeper hashes each element to one bucket in each of depth arrays of
+// width buckets. A bucket holds a fingerprint and a count. If the bucket is
+// empty or holds the element's fingerprint, the count is incremented.
+// Otherwise, the count is decremented with a probability which decays
+// exponentially with the count, b^-count, and the bucket is taken over by the
+// element once the count reaches zero. Elements with few occurrences rarely
+// displace frequent ones, so the counts of large elements are accurate while
+// the small ones are quickly decayed away. A min-heap tracks the k elements
+// with the largest estimated counts.
+//
+// Compared to TopK, which relies on a Count-Min Sketch whose counts are
+// inflated by collisions with the many small elements, HeavyKeeper provides
+// much higher precision on highly skewed, high-rate streams. Counts are
+// usually underestimated, but elements whose fingerprints collide in a bucket
+// share its count, which can overestimate them.
+type HeavyKeeper struct {
+	buckets  [][]hkBucket // bucket arrays
+	width    uint         // number of buckets per array
+	depth    uint         // number of arrays
+	decay    float64      // exponential decay base, b
+	k        uint         // number of top elements
+	elements *indexedHeap // top-k elements
+	hash     hash.Hash64  // hash function (kernel for all depth functions)
+}
+
+// NewHeavyKeeper creates a new HeavyKeeper which tracks the k most frequent
+// elements using depth arrays of width buckets and the given exponential
+// decay base, which must be greater than 1. K, width, and depth are at least
+// 1, and a decay base of 1 or less is replaced by the default of 1.08.
+func NewHeavyKeeper(k, width, depth uint, decay float64) *HeavyKeeper {
+	if k == 0 {
+		k = 1
+	}
+	if width == 0 {
+		width = 1
+	}
+	if depth == 0 {
+		depth = 1
+	}
+	if !(decay > 1) {
+		decay = defaultHeavyKeeperDecay
+	}
+
+	buckets := make([][]hkBucket, depth)
+	for i := range buckets {
+		buckets[i] = make([]hkBucket, width)
+	}
+
+	return &HeavyKeeper{
+		buckets:  buckets,
+		width:    width,
+		depth:    depth,
+		decay:    decay,
+		k:        k,
+		elements: newIndexedHeap(k),
+		hash:     fnv.New64(),
+	}
+}
+
+// NewDefaultHeavyKeeper creates a new HeavyKeeper which tracks the k most
+// frequent elements using two arrays of 8k (at least 256) buckets and a decay
+// base of 1.08.
+func NewDefaultHeavyKeeper(k uint) *HeavyKeeper {
+	width := 8 * k
+	if width < 256 {
+		width = 256
+	}
+	return NewHeavyKeeper(k, width, 2, defaultHeavyKeeperDecay)
+}
+
+// Add will add the data to the HeavyKeeper and update the top-k heap if
+// applicable. Returns the HeavyKeeper to allow for chaining.
+func (h *HeavyKeeper) Add(data []byte) *HeavyKeeper {
+	var (
+		lower, upper = hashKernel(data, h.hash)
+		fingerprint  = upper
+		freq         = uint64(0)
+	)
+
+	for i := uint(0); i < h.depth; i++ {
+		b := &h.buckets[i][(uint(lower)+uint(upper)*i)%h.width]
+		switch {
+		case b.count == 0:
+			b.fingerprint = fingerprint
+			b.count = 1
+		case b.fingerprint == fingerprint:
+			b.count++
+		case rand.Float64() < math.Pow(h.decay, -float64(b.count)):
+			b.count--
+			if b.count == 0 {
+				b.fingerprint = fingerprint
+				b.count = 1
+			}
+		}
+
+		if b.fingerprint == fingerprint && b.count > freq {
+			freq = b.count
+		}
+	}
+
+	if freq > 0 && h.isTop(freq) {
+		h.insert(data, freq)
+	}
+
+	return h
+}
+
+// Count returns the estimated count for the data. It's usually
+// underestimated, but can be overestimated if another element with the same
+// fingerprint shares one of its buckets.
+func (h *HeavyKeeper) Count(data []byte) uint64 {
+	var (
+		lower, upper = hashKernel(data, h.hash)
+		freq         = uint64(0)
+	)
+
+	for i := uint(0); i < h.depth; i++ {
+		b := h.buckets[i][(uint(lower)+uint(upper)*i)%h.width]
+		if b.fingerprint == upper && b.count > freq {
+			freq = b.count
+		}
+	}
+	return freq
+}
+
+// Elements returns the top-k elements from lowest to highest frequency.
+func (h *HeavyKeeper) Elements() []*Element {
+	return h.elements.sorted()
+}
+
+// Reset restores the HeavyKeeper to its original state. It returns itself to
+// allow for chaining.
+func (h *HeavyKeeper) Reset() *HeavyKeeper {
+	for i := range h.buckets {
+		for j := range h.buckets[i] {
+			h.buckets[i][j] = hkBucket{}
+		}
+	}
+	h.elements = newIndexedHeap(h.k)
+	return h
+}
+
+// SetHash sets the hashing function used.
+func (h *HeavyKeeper) SetHash(ha hash.Hash64) {
+	h.hash = ha
+}
+
+// isTop indicates if the given frequency falls within the top-k heap.
+func (h *HeavyKeeper) isTop(freq uint64) bool {
+	if h.elements.Len() < int(h.k) {
+		return true
+	}
+
+	return freq >= h.elements.min().Freq
+}
+
+// insert adds the data to the top-k heap. If the data is already an element,
+// the frequency is updated. If the heap already has k elements, the element
+// with the minimum frequency is removed.
+func (h *HeavyKeeper) insert(data []byte, freq uint64) {
+	if _, ok := h.elements.index[string(data)]; !ok {
+		// The data is copied since the caller may reuse it.
+		data = append([]byte(nil), data...)
+	}
+	h.elements.update(data, freq, h.k)
+}
+
+// WriteTo writes a binary representation of the HeavyKeeper to an i/o
+// stream. It returns the number of bytes written.
+func (h *HeavyKeeper) WriteTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, uint64(h.k))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(h.width))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(h.depth))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, h.decay)
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range h.buckets {
+		for _, b := range row {
+			err = binary.Write(stream, binary.BigEndian, b.fingerprint)
+			if err != nil {
+				return 0, err
+			}
+			err = binary.Write(stream, binary.BigEndian, b.count)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(h.elements.Len()))
+	if err != nil {
+		return 0, err
+	}
+	numBytes := int64(5*binary.Size(uint64(0))) +
+		int64(h.width*h.depth)*int64(binary.Size(uint32(0))+binary.Size(uint64(0)))
+	for _, element := range h.elements.elements {
+		err = binary.Write(stream, binary.BigEndian, element.Freq)
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Write(stream, binary.BigEndian, uint64(len(element.Data)))
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Write(stream, binary.BigEndian, element.Data)
+		if err != nil {
+			return 0, err
+		}
+		numBytes += int64(2*binary.Size(uint64(0)) + len(element.Data))
+	}
+	return numBytes, nil
+}
+
+// ReadFrom reads a binary representation of HeavyKeeper (such as might have
+// been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (h *HeavyKeeper) ReadFrom(stream io.Reader) (int64, error) {
+	var k, width, depth, len uint64
+	var decay float64
+	err := binary.Read(stream, binary.BigEndian, &k)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &width)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &depth)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &decay)
+	if err != nil {
+		return 0, err
+	}
+
+	hash := h.hash
+	*h = *NewHeavyKeeper(uint(k), uint(width), uint(depth), decay)
+	if hash != nil {
+		h.hash = hash
+	}
+	for _, row := range h.buckets {
+		for j := range row {
+			err = binary.Read(stream, binary.BigEndian, &row[j].fingerprint)
+			if err != nil {
+				return 0, err
+			}
+			err = binary.Read(stream, binary.BigEndian, &row[j].count)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	err = binary.Read(stream, binary.BigEndian, &len)
+	if err != nil {
+		return 0, err
+	}
+	numBytes := int64(5*binary.Size(uint64(0))) +
+		int64(width*depth)*int64(binary.Size(uint32(0))+binary.Size(uint64(0)))
+	for i := uint64(0); i < len; i++ {
+		var freq, size uint64
+		err = binary.Read(stream, binary.BigEndian, &freq)
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Read(stream, binary.BigEndian, &size)
+		if err != nil {
+			return 0, err
+		}
+		data := make([]byte, size)
+		err = binary.Read(stream, binary.BigEndian, data)
+		if err != nil {
+			return 0, err
+		}
+		heap.Push(h.elements, &Element{Data: data, Freq: freq})
+		numBytes += int64(2*binary.Size(uint64(0))) + int64(size)
+	}
+	return numBytes, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (h *HeavyKeeper) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := h.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (h *HeavyKeeper) GobDecode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := h.ReadFrom(buf)
+
+	return err
+}
@@ -0,0 +1,171 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strconv"
+	"testing"
+)
+
+// Ensures that HeavyKeeper returns the top-k most frequent elements.
+func TestHeavyKeeper(t *testing.T) {
+	hk := NewDefaultHeavyKeeper(3)
+
+	hk.Add([]byte(`bob`)).Add([]byte(`bob`)).Add([]byte(`bob`))
+	hk.Add([]byte(`tyler`)).Add([]byte(`tyler`)).Add([]byte(`tyler`)).Add([]byte(`tyler`)).Add([]byte(`tyler`))
+	hk.Add([]byte(`fred`))
+	hk.Add([]byte(`alice`)).Add([]byte(`alice`)).Add([]byte(`alice`)).Add([]byte(`alice`))
+	hk.Add([]byte(`james`))
+
+	if hk.Add([]byte(`fred`)) != hk {
+		t.Error("Returned HeavyKeeper should be the same instance")
+	}
+
+	expected := []struct {
+		name string
+		freq uint64
+	}{
+		{"bob", 3},
+		{"alice", 4},
+		{"tyler", 5},
+	}
+
+	actual := hk.Elements()
+	if l := len(actual); l != 3 {
+		t.Fatalf("expected len 3, got %d", l)
+	}
+
+	for i, element := range actual {
+		if e := string(element.Data); e != expected[i].name {
+			t.Errorf("expected %s, got %s", expected[i].name, e)
+		}
+		if freq := element.Freq; freq != expected[i].freq {
+			t.Errorf("expected %d, got %d", expected[i].freq, freq)
+		}
+	}
+
+	if count := hk.Count([]byte(`fred`)); count != 2 {
+		t.Errorf("expected 2, got %d", count)
+	}
+
+	if hk.Reset() != hk {
+		t.Error("Returned HeavyKeeper should be the same instance")
+	}
+
+	if l := len(hk.Elements()); l != 0 {
+		t.Errorf("expected 0, got %d", l)
+	}
+
+	if count := hk.Count([]byte(`tyler`)); count != 0 {
+		t.Errorf("expected 0, got %d", count)
+	}
+}
+
+// Ensures that HeavyKeeper finds the heavy hitters in a stream dominated by
+// many small elements without overestimating their counts.
+func TestHeavyKeeperSkewed(t *testing.T) {
+	hk := NewHeavyKeeper(5, 256, 2, 1.08)
+	for i := 0; i < 20000; i++ {
+		hk.Add([]byte(strconv.Itoa(i)))
+		if i%4 == 0 {
+			hk.Add([]byte(`heavy` + strconv.Itoa(i%20/4)))
+		}
+	}
+
+	actual := hk.Elements()
+	if l := len(actual); l != 5 {
+		t.Fatalf("expected len 5, got %d", l)
+	}
+
+	for _, element := range actual {
+		if !bytes.HasPrefix(element.Data, []byte(`heavy`)) {
+			t.Errorf("expected heavy element, got %s", element.Data)
+		}
+		if element.Freq > 1000 || element.Freq < 900 {
+			t.Errorf("expected about 1000, got %d", element.Freq)
+		}
+	}
+}
+
+// Ensures that HeavyKeeper can be serialized and deserialized.
+func TestHeavyKeeperSerialization(t *testing.T) {
+	hk := NewDefaultHeavyKeeper(5)
+	for i := 0; i < 1000; i++ {
+		hk.Add([]byte(strconv.Itoa(i % 50)))
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(hk); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &HeavyKeeper{}
+	if err := gob.NewDecoder(&buf).Decode(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, actual := hk.Elements(), decoded.Elements()
+	if len(expected) != len(actual) {
+		t.Fatalf("expected len %d, got %d", len(expected), len(actual))
+	}
+	for i := range expected {
+		if !bytes.Equal(expected[i].Data, actual[i].Data) || expected[i].Freq != actual[i].Freq {
+			t.Errorf("expected %s %d, got %s %d", expected[i].Data, expected[i].Freq,
+				actual[i].Data, actual[i].Freq)
+		}
+	}
+
+	wn, err := hk.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded = NewDefaultHeavyKeeper(1)
+	rn, err := decoded.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wn != rn {
+		t.Errorf("expected %d bytes read, got %d", wn, rn)
+	}
+
+	if expected, count := hk.Count([]byte(`7`)), decoded.Count([]byte(`7`)); expected != count {
+		t.Errorf("expected %d, got %d", expected, count)
+	}
+}
+
+// Ensures that NewHeavyKeeper replaces invalid k, dimensions, and decay bases.
+func TestHeavyKeeperParameters(t *testing.T) {
+	hk := NewHeavyKeeper(0, 0, 0, 1)
+	if hk.k != 1 {
+		t.Errorf("Expected k 1, got %d", hk.k)
+	}
+
+	if hk.width != 1 || hk.depth != 1 {
+		t.Errorf("Expected 1x1 buckets, got %dx%d", hk.depth, hk.width)
+	}
+
+	if hk.decay != 1.08 {
+		t.Errorf("Expected decay 1.08, got %f", hk.decay)
+	}
+
+	hk.Add([]byte(`bob`)).Add([]byte(`bob`))
+	if count := hk.Count([]byte(`bob`)); count != 2 {
+		t.Errorf("expected 2, got %d", count)
+	}
+}
+
+func BenchmarkHeavyKeeperAdd(b *testing.B) {
+	b.StopTimer()
+	hk := NewDefaultHeavyKeeper(100)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i % 10000))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		hk.Add(data[n])
+	}
+}
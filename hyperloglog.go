@@ -251,3 +251,230 @@ func (h *HyperLogLog) ReadDataFrom(stream io.Reader) (int, error) {
 
 	return size, err
 }
+
+// Union returns a new HyperLogLog which estimates the cardinality of the union
+// of this HyperLogLog and the others. Unlike Merge, none of the HyperLogLogs
+// are modified. Returns an error if the number of registers don't match.
+func (h *HyperLogLog) Union(others ...*HyperLogLog) (*HyperLogLog, error) {
+	union := h.copy()
+	for _, other := range others {
+		if err := union.Merge(other); err != nil {
+			return nil, err
+		}
+	}
+	return union, nil
+}
+
+// Intersection returns the approximated cardinality of the intersection of
+// this HyperLogLog and the others using the inclusion-exclusion principle over
+// the unions of every subset. The error of the estimate grows with the number
+// of sets and is relative to the size of the union rather than the
+// intersection, so it's poor for small overlaps. For two sets, consider
+// IntersectionMLE instead. Returns an error if the number of registers don't
+// match.
+func (h *HyperLogLog) Intersection(others ...*HyperLogLog) (uint64, error) {
+	sets := append([]*HyperLogLog{h}, others...)
+	for _, other := range others {
+		if h.m != other.m {
+			return 0, errors.New("number of registers must match")
+		}
+	}
+	if len(sets) > 16 {
+		return 0, errors.New("too many sets for inclusion-exclusion")
+	}
+
+	var (
+		estimate = 0.0
+		smallest = uint64(math.MaxUint64)
+		union    = h.copy()
+	)
+	for subset := 1; subset < 1<<uint(len(sets)); subset++ {
+		union.Reset()
+		size := 0
+		for i, set := range sets {
+			if subset&(1<<uint(i)) != 0 {
+				union.Merge(set)
+				size++
+			}
+		}
+		count := union.Count()
+		if size == 1 && count < smallest {
+			smallest = count
+		}
+		if size%2 == 1 {
+			estimate += float64(count)
+		} else {
+			estimate -= float64(count)
+		}
+	}
+
+	// The estimate can't be negative or exceed the smallest set.
+	if estimate < 0 {
+		return 0, nil
+	}
+	if uint64(estimate) > smallest {
+		return smallest, nil
+	}
+	return uint64(estimate), nil
+}
+
+// Jaccard returns the approximated Jaccard similarity, the ratio of the
+// intersection cardinality to the union cardinality, of this HyperLogLog and
+// the others. Returns an error if the number of registers don't match.
+func (h *HyperLogLog) Jaccard(others ...*HyperLogLog) (float64, error) {
+	intersection, err := h.Intersection(others...)
+	if err != nil {
+		return 0, err
+	}
+	union, err := h.Union(others...)
+	if err != nil {
+		return 0, err
+	}
+	count := union.Count()
+	if count == 0 {
+		return 0, nil
+	}
+	return float64(intersection) / float64(count), nil
+}
+
+// IntersectionMLE returns the approximated cardinality of the intersection of
+// this HyperLogLog and another using the joint maximum-likelihood estimation
+// method described by Ertl in New cardinality estimation algorithms for
+// HyperLogLog sketches:
+//
+// https://arxiv.org/abs/1702.01284
+//
+// The register values of both sketches are modeled as the maxima of three
+// independent Poisson processes for the elements only in this set, only in
+// the other set, and in both. The rates which maximize the joint likelihood
+// of the observed register pairs are found numerically. This is considerably
+// more accurate than inclusion-exclusion when the overlap is small relative to
+// the sets. Returns an error if the number of registers don't match.
+func (h *HyperLogLog) IntersectionMLE(other *HyperLogLog) (uint64, error) {
+	if h.m != other.m {
+		return 0, errors.New("number of registers must match")
+	}
+
+	// Only the histogram of register value pairs affects the likelihood.
+	var (
+		q     = uint(32 - h.b)
+		width = int(q) + 2
+		pairs = make(map[int]float64)
+	)
+	for j := uint(0); j < h.m; j++ {
+		pairs[int(h.registers[j])*width+int(other.registers[j])]++
+	}
+
+	// Use inclusion-exclusion to find a starting point.
+	countA, countB := float64(h.Count()), float64(other.Count())
+	union, _ := h.Union(other)
+	countX := countA + countB - float64(union.Count())
+	if countX < 1 {
+		countX = 1
+	}
+	params := [3]float64{
+		math.Log(math.Max(countA-countX, 1)),
+		math.Log(math.Max(countB-countX, 1)),
+		math.Log(countX),
+	}
+
+	var (
+		m          = float64(h.m)
+		likelihood = func(params [3]float64) float64 {
+			return jointLogLikelihood(pairs, width, q, m,
+				math.Exp(params[0]), math.Exp(params[1]), math.Exp(params[2]))
+		}
+		lo   = -1.0
+		hi   = math.Log(m) + float64(q)*math.Ln2 + 1
+		prev = likelihood(params)
+	)
+
+	// Maximize the log-likelihood over the log-rates by coordinate ascent.
+	for iter := 0; iter < 50; iter++ {
+		for i := range params {
+			params[i] = maximize(func(x float64) float64 {
+				p := params
+				p[i] = x
+				return likelihood(p)
+			}, lo, hi)
+		}
+		l := likelihood(params)
+		if math.Abs(l-prev) < 1e-9 {
+			break
+		}
+		prev = l
+	}
+
+	return uint64(math.Exp(params[2]) + 0.5), nil
+}
+
+// copy returns a new HyperLogLog with the same configuration and registers.
+func (h *HyperLogLog) copy() *HyperLogLog {
+	registers := make([]uint8, h.m)
+	copy(registers, h.registers)
+	return &HyperLogLog{
+		registers: registers,
+		m:         h.m,
+		b:         h.b,
+		alpha:     h.alpha,
+		hash:      h.hash,
+	}
+}
+
+// jointLogLikelihood returns the log-likelihood of the histogram of register
+// value pairs given Poisson rates for elements only in the first set, a, only
+// in the second set, b, and in both sets, x.
+func jointLogLikelihood(pairs map[int]float64, width int, q uint, m, a, b, x float64) float64 {
+	// cdf returns the probability that a register with rate l is at most k.
+	cdf := func(l float64, k int) float64 {
+		if k < 0 {
+			return 0
+		}
+		if k > int(q) {
+			return 1
+		}
+		return math.Exp(-l / m * math.Pow(2, -float64(k)))
+	}
+	joint := func(i, j int) float64 {
+		k := i
+		if j < k {
+			k = j
+		}
+		return cdf(a, i) * cdf(b, j) * cdf(x, k)
+	}
+
+	sum := 0.0
+	for pair, n := range pairs {
+		i, j := pair/width, pair%width
+		p := joint(i, j) - joint(i-1, j) - joint(i, j-1) + joint(i-1, j-1)
+		if p <= 0 {
+			p = math.SmallestNonzeroFloat64
+		}
+		sum += n * math.Log(p)
+	}
+	return sum
+}
+
+// maximize returns the argument in [lo, hi] which maximizes the unimodal
+// function f using golden-section search.
+func maximize(f func(float64) float64, lo, hi float64) float64 {
+	const ratio = 0.6180339887498949
+	var (
+		x1 = hi - ratio*(hi-lo)
+		x2 = lo + ratio*(hi-lo)
+		f1 = f(x1)
+		f2 = f(x2)
+	)
+	for hi-lo > 1e-6 {
+		if f1 < f2 {
+			lo, x1, f1 = x1, x2, f2
+			x2 = lo + ratio*(hi-lo)
+			f2 = f(x2)
+		} else {
+			hi, x2, f2 = x2, x1, f1
+			x1 = hi - ratio*(hi-lo)
+			f1 = f(x1)
+		}
+	}
+	return (lo + hi) / 2
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"math/rand"
 	"os"
 	"strings"
 	"testing"
@@ -282,3 +283,134 @@ func BenchmarkHLLCount9(b *testing.B) {
 func BenchmarkHLLCount10(b *testing.B) {
 	benchmarkCount(b, 10)
 }
+
+// randomKeys returns n distinct pseudo-random keys. Sequential numeric keys
+// aren't used since 32-bit FNV spreads them poorly across registers.
+func randomKeys(n int) [][]byte {
+	r := rand.New(rand.NewSource(42))
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = make([]byte, 16)
+		r.Read(keys[i])
+	}
+	return keys
+}
+
+// Ensures that Union returns a new HyperLogLog estimating the union without
+// modifying the inputs.
+func TestHyperLogLogUnion(t *testing.T) {
+	keys := randomKeys(1500)
+	a, _ := NewHyperLogLog(1024)
+	b, _ := NewHyperLogLog(1024)
+	for _, key := range keys[:1000] {
+		a.Add(key)
+	}
+	for _, key := range keys[500:] {
+		b.Add(key)
+	}
+	countA, countB := a.Count(), b.Count()
+
+	union, err := a.Union(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := union.Count(); math.Abs(geterror(1500, count)) > 0.1 {
+		t.Errorf("expected about 1500, got %d", count)
+	}
+
+	if a.Count() != countA || b.Count() != countB {
+		t.Error("Union should not modify the HyperLogLogs")
+	}
+
+	other, _ := NewHyperLogLog(512)
+	if _, err := a.Union(other); err == nil {
+		t.Error("expected error for mismatched registers")
+	}
+}
+
+// Ensures that Intersection and Jaccard return approximations based on
+// inclusion-exclusion.
+func TestHyperLogLogIntersectionAndJaccard(t *testing.T) {
+	keys := randomKeys(15000)
+	a, _ := NewHyperLogLog(4096)
+	b, _ := NewHyperLogLog(4096)
+	c, _ := NewHyperLogLog(4096)
+	for _, key := range keys[:10000] {
+		a.Add(key)
+	}
+	for _, key := range keys[5000:] {
+		b.Add(key)
+	}
+	for _, key := range keys[2500:12500] {
+		c.Add(key)
+	}
+
+	count, err := a.Intersection(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(geterror(5000, count)) > 0.1 {
+		t.Errorf("expected about 5000, got %d", count)
+	}
+
+	count, err = a.Intersection(b, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(geterror(5000, count)) > 0.2 {
+		t.Errorf("expected about 5000, got %d", count)
+	}
+
+	jaccard, err := a.Jaccard(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(jaccard-1.0/3.0) > 0.05 {
+		t.Errorf("expected about 0.33, got %f", jaccard)
+	}
+
+	other, _ := NewHyperLogLog(512)
+	if _, err := a.Intersection(other); err == nil {
+		t.Error("expected error for mismatched registers")
+	}
+}
+
+// Ensures that IntersectionMLE returns an accurate approximation for small
+// overlaps.
+func TestHyperLogLogIntersectionMLE(t *testing.T) {
+	keys := randomKeys(91000)
+	a, _ := NewHyperLogLog(4096)
+	b, _ := NewHyperLogLog(4096)
+	c, _ := NewHyperLogLog(4096)
+	for _, key := range keys[:50000] {
+		a.Add(key)
+	}
+	for _, key := range keys[40000:90000] {
+		b.Add(key)
+	}
+	for _, key := range keys[90000:] {
+		c.Add(key)
+	}
+
+	count, err := a.IntersectionMLE(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(geterror(10000, count)) > 0.1 {
+		t.Errorf("expected about 10000, got %d", count)
+	}
+
+	count, err = a.IntersectionMLE(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count > 100 {
+		t.Errorf("expected about 0, got %d", count)
+	}
+
+	other, _ := NewHyperLogLog(512)
+	if _, err := a.IntersectionMLE(other); err == nil {
+		t.Error("expected error for mismatched registers")
+	}
+}
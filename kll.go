@@ -0,0 +1,400 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	// kllMinCapacity is the minimum capacity of a compactor.
+	kllMinCapacity = 8
+
+	// kllDecay is the rate at which compactor capacities decrease for lower
+	// levels.
+	kllDecay = 2.0 / 3.0
+)
+
+// weightedValue is a value retained by a quantile sketch along with the number
+// of values it represents.
+type weightedValue struct {
+	value  float64
+	weight uint64
+}
+
+// KLLSketch implements the KLL quantile sketch as described by Karnin, Lang,
+// and Liberty in Optimal Quantile Approximation in Streams:
+//
+// https://arxiv.org/abs/1603.05346
+//
+// A KLL sketch approximates the distribution of a stream of values using a
+// hierarchy of compactors. Values are added to the lowest level. When a level
+// exceeds its capacity, it is sorted and every other value, starting from a
+// random offset, is promoted to the next level where each value represents
+// twice as many. Capacities decrease geometrically toward the lowest levels,
+// which keeps the total size proportional to k.
+//
+// Unlike t-digest, KLL provides a guaranteed bound on the rank error. For a
+// sketch with parameter k, the rank of any value is estimated within
+// NormalizedRankError of its true rank with high probability, independent of
+// the distribution of the data. Sketches with the same k can be merged.
+type KLLSketch struct {
+	levels [][]float64 // compactors ordered by level, each value weighted 2^level
+	k      uint        // top level capacity
+	n      uint64      // number of values added
+	size   uint        // number of retained values
+	min    float64     // minimum value added
+	max    float64     // maximum value added
+}
+
+// NewKLLSketch creates a new KLL sketch with the given parameter k, which
+// controls the trade-off between accuracy and size.
+func NewKLLSketch(k uint) *KLLSketch {
+	if k < kllMinCapacity {
+		k = kllMinCapacity
+	}
+	return &KLLSketch{
+		levels: [][]float64{make([]float64, 0, k)},
+		k:      k,
+		min:    math.Inf(1),
+		max:    math.Inf(-1),
+	}
+}
+
+// NewDefaultKLLSketch creates a new KLL sketch with k = 200, which has a
+// normalized rank error of about 1.65%.
+func NewDefaultKLLSketch() *KLLSketch {
+	return NewKLLSketch(200)
+}
+
+// K returns the parameter k.
+func (k *KLLSketch) K() uint {
+	return k.k
+}
+
+// Count returns the number of values added to the sketch.
+func (k *KLLSketch) Count() uint64 {
+	return k.n
+}
+
+// Min returns the minimum value added to the sketch.
+func (k *KLLSketch) Min() float64 {
+	return k.min
+}
+
+// Max returns the maximum value added to the sketch.
+func (k *KLLSketch) Max() float64 {
+	return k.max
+}
+
+// NormalizedRankError returns the approximate rank error, as a fraction of the
+// number of values, which holds with 99% confidence. This uses the empirical
+// approximation for single-sided queries such as Rank and Quantile.
+func (k *KLLSketch) NormalizedRankError() float64 {
+	return 2.296 / math.Pow(float64(k.k), 0.9723)
+}
+
+// Update will add the value to the sketch. NaN values are ignored. Returns the
+// KLLSketch to allow for chaining.
+func (k *KLLSketch) Update(value float64) *KLLSketch {
+	if math.IsNaN(value) {
+		return k
+	}
+
+	if value < k.min {
+		k.min = value
+	}
+	if value > k.max {
+		k.max = value
+	}
+
+	k.levels[0] = append(k.levels[0], value)
+	k.n++
+	k.size++
+	k.compress()
+	return k
+}
+
+// Rank returns the approximate fraction of values which are less than or
+// equal to the given value. Returns NaN if the sketch is empty.
+func (k *KLLSketch) Rank(value float64) float64 {
+	if k.n == 0 {
+		return math.NaN()
+	}
+
+	rank := uint64(0)
+	for h, level := range k.levels {
+		for _, v := range level {
+			if v <= value {
+				rank += 1 << uint(h)
+			}
+		}
+	}
+	return float64(rank) / float64(k.n)
+}
+
+// Quantile returns the approximate value at the given fraction, q, which must
+// be between 0 and 1. Returns NaN if the sketch is empty.
+func (k *KLLSketch) Quantile(q float64) float64 {
+	return k.Quantiles([]float64{q})[0]
+}
+
+// Quantiles returns the approximate values at each of the given fractions,
+// which must be between 0 and 1. This is more efficient than calling Quantile
+// repeatedly. Values are NaN if the sketch is empty.
+func (k *KLLSketch) Quantiles(fractions []float64) []float64 {
+	quantiles := make([]float64, len(fractions))
+	if k.n == 0 {
+		for i := range quantiles {
+			quantiles[i] = math.NaN()
+		}
+		return quantiles
+	}
+
+	view := k.sortedView()
+	for i, q := range fractions {
+		switch {
+		case q < 0 || q > 1:
+			quantiles[i] = math.NaN()
+		case q == 0:
+			quantiles[i] = k.min
+		case q == 1:
+			quantiles[i] = k.max
+		default:
+			quantiles[i] = view.quantile(q, k.n)
+		}
+	}
+	return quantiles
+}
+
+// Merge combines this KLL sketch with another. The other sketch is not
+// modified. Returns an error if the parameter k doesn't match.
+func (k *KLLSketch) Merge(other *KLLSketch) error {
+	if k.k != other.k {
+		return errors.New("k must match")
+	}
+
+	for len(k.levels) < len(other.levels) {
+		k.levels = append(k.levels, make([]float64, 0, kllMinCapacity))
+	}
+	for h, level := range other.levels {
+		k.levels[h] = append(k.levels[h], level...)
+		k.size += uint(len(level))
+	}
+
+	if other.min < k.min {
+		k.min = other.min
+	}
+	if other.max > k.max {
+		k.max = other.max
+	}
+
+	k.n += other.n
+	k.compress()
+	return nil
+}
+
+// Reset restores the KLLSketch to its original state. It returns itself to
+// allow for chaining.
+func (k *KLLSketch) Reset() *KLLSketch {
+	k.levels = [][]float64{make([]float64, 0, k.k)}
+	k.n = 0
+	k.size = 0
+	k.min = math.Inf(1)
+	k.max = math.Inf(-1)
+	return k
+}
+
+// capacity returns the capacity of the compactor at the given level.
+func (k *KLLSketch) capacity(level int) uint {
+	depth := len(k.levels) - level - 1
+	capacity := uint(math.Ceil(float64(k.k) * math.Pow(kllDecay, float64(depth))))
+	if capacity < kllMinCapacity {
+		capacity = kllMinCapacity
+	}
+	return capacity
+}
+
+// maxSize returns the total capacity of all compactors.
+func (k *KLLSketch) maxSize() uint {
+	size := uint(0)
+	for h := range k.levels {
+		size += k.capacity(h)
+	}
+	return size
+}
+
+// compress compacts the lowest full level until the number of retained values
+// is within the total capacity.
+func (k *KLLSketch) compress() {
+	for k.size >= k.maxSize() {
+		for h := range k.levels {
+			if uint(len(k.levels[h])) >= k.capacity(h) {
+				k.compact(h)
+				break
+			}
+		}
+	}
+}
+
+// compact sorts the level and promotes every other value, starting from a
+// random offset, to the next level. If the level has an odd number of values,
+// the smallest is kept.
+func (k *KLLSketch) compact(h int) {
+	if h+1 == len(k.levels) {
+		k.levels = append(k.levels, make([]float64, 0, k.k))
+	}
+
+	level := k.levels[h]
+	sort.Float64s(level)
+
+	keep := len(level) % 2
+	for i := keep + rand.Intn(2); i < len(level); i += 2 {
+		k.levels[h+1] = append(k.levels[h+1], level[i])
+	}
+
+	k.size -= uint(len(level)-keep) / 2
+	k.levels[h] = level[:keep]
+}
+
+// sortedView returns the retained values and their weights sorted by value.
+func (k *KLLSketch) sortedView() quantileView {
+	view := make(quantileView, 0, k.size)
+	for h, level := range k.levels {
+		for _, v := range level {
+			view = append(view, weightedValue{value: v, weight: 1 << uint(h)})
+		}
+	}
+	sort.Slice(view, func(i, j int) bool { return view[i].value < view[j].value })
+	return view
+}
+
+// quantileView is a sorted set of weighted values.
+type quantileView []weightedValue
+
+// quantile returns the smallest value whose cumulative weight is at least the
+// fraction q of the total weight n.
+func (v quantileView) quantile(q float64, n uint64) float64 {
+	var (
+		target     = uint64(math.Ceil(q * float64(n)))
+		cumulative = uint64(0)
+	)
+	for _, wv := range v {
+		cumulative += wv.weight
+		if cumulative >= target {
+			return wv.value
+		}
+	}
+	return v[len(v)-1].value
+}
+
+// WriteTo writes a binary representation of the KLLSketch to an i/o stream.
+// It returns the number of bytes written.
+func (k *KLLSketch) WriteTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, uint64(k.k))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, k.n)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, k.min)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, k.max)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(len(k.levels)))
+	if err != nil {
+		return 0, err
+	}
+	for _, level := range k.levels {
+		err = binary.Write(stream, binary.BigEndian, uint64(len(level)))
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Write(stream, binary.BigEndian, level)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return int64((5 + len(k.levels) + int(k.size)) * binary.Size(uint64(0))), nil
+}
+
+// ReadFrom reads a binary representation of KLLSketch (such as might have been
+// written by WriteTo()) from an i/o stream. It returns the number of bytes
+// read.
+func (k *KLLSketch) ReadFrom(stream io.Reader) (int64, error) {
+	var kk, n, numLevels uint64
+	var min, max float64
+	err := binary.Read(stream, binary.BigEndian, &kk)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &n)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &min)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &max)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &numLevels)
+	if err != nil {
+		return 0, err
+	}
+	size := uint(0)
+	levels := make([][]float64, numLevels)
+	for h := range levels {
+		var len uint64
+		err = binary.Read(stream, binary.BigEndian, &len)
+		if err != nil {
+			return 0, err
+		}
+		levels[h] = make([]float64, len)
+		err = binary.Read(stream, binary.BigEndian, levels[h])
+		if err != nil {
+			return 0, err
+		}
+		size += uint(len)
+	}
+
+	k.k = uint(kk)
+	k.n = n
+	k.min = min
+	k.max = max
+	k.levels = levels
+	k.size = size
+	return int64((5 + len(levels) + int(size)) * binary.Size(uint64(0))), nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (k *KLLSketch) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := k.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (k *KLLSketch) GobDecode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := k.ReadFrom(buf)
+
+	return err
+}
@@ -0,0 +1,170 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Ensures that Rank and Quantile are within the normalized rank error.
+func TestKLLRankAndQuantile(t *testing.T) {
+	s := NewDefaultKLLSketch()
+	values := rand.New(rand.NewSource(1)).Perm(100000)
+	for _, v := range values {
+		if s.Update(float64(v)) != s {
+			t.Fatal("Returned KLLSketch should be the same instance")
+		}
+	}
+
+	if count := s.Count(); count != 100000 {
+		t.Errorf("expected 100000, got %d", count)
+	}
+
+	if size := s.size; size > 3*s.K() {
+		t.Errorf("expected at most %d retained values, got %d", 3*s.K(), size)
+	}
+
+	eps := s.NormalizedRankError()
+	if eps < 0.01 || eps > 0.02 {
+		t.Errorf("expected about 0.0165, got %f", eps)
+	}
+
+	for _, q := range []float64{0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99} {
+		if rank := s.Rank(q * 100000); math.Abs(rank-q) > eps {
+			t.Errorf("expected rank about %f, got %f", q, rank)
+		}
+		if quantile := s.Quantile(q); math.Abs(quantile/100000-q) > eps {
+			t.Errorf("expected quantile about %f, got %f", q*100000, quantile)
+		}
+	}
+
+	quantiles := s.Quantiles([]float64{0, 0.5, 1, 2})
+	if quantiles[0] != 0 || quantiles[2] != 99999 {
+		t.Errorf("expected 0 and 99999, got %f and %f", quantiles[0], quantiles[2])
+	}
+	if math.Abs(quantiles[1]/100000-0.5) > eps {
+		t.Errorf("expected about 50000, got %f", quantiles[1])
+	}
+	if !math.IsNaN(quantiles[3]) {
+		t.Errorf("expected NaN, got %f", quantiles[3])
+	}
+}
+
+// Ensures that Rank and Quantile are exact for small streams.
+func TestKLLExact(t *testing.T) {
+	s := NewDefaultKLLSketch()
+	if !math.IsNaN(s.Rank(1)) || !math.IsNaN(s.Quantile(0.5)) {
+		t.Error("expected NaN for empty sketch")
+	}
+
+	for i := 1; i <= 100; i++ {
+		s.Update(float64(i))
+	}
+	s.Update(math.NaN())
+
+	if rank := s.Rank(50); rank != 0.5 {
+		t.Errorf("expected 0.5, got %f", rank)
+	}
+
+	if median := s.Quantile(0.5); median != 50 {
+		t.Errorf("expected 50, got %f", median)
+	}
+}
+
+// Ensures that Merge combines the sketches.
+func TestKLLMerge(t *testing.T) {
+	merged := NewDefaultKLLSketch()
+	for i := 0; i < 10; i++ {
+		s := NewDefaultKLLSketch()
+		for j := 0; j < 10000; j++ {
+			s.Update(float64(i*10000 + j))
+		}
+		if err := merged.Merge(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count := merged.Count(); count != 100000 {
+		t.Errorf("expected 100000, got %d", count)
+	}
+
+	if min, max := merged.Min(), merged.Max(); min != 0 || max != 99999 {
+		t.Errorf("expected 0 and 99999, got %f and %f", min, max)
+	}
+
+	eps := merged.NormalizedRankError()
+	for _, q := range []float64{0.01, 0.5, 0.99} {
+		if quantile := merged.Quantile(q); math.Abs(quantile/100000-q) > eps {
+			t.Errorf("expected about %f, got %f", q*100000, quantile)
+		}
+	}
+
+	if err := merged.Merge(NewKLLSketch(100)); err == nil {
+		t.Error("expected error for mismatched k")
+	}
+}
+
+// Ensures that Reset restores the sketch to its original state.
+func TestKLLReset(t *testing.T) {
+	s := NewDefaultKLLSketch()
+	for i := 0; i < 10000; i++ {
+		s.Update(float64(i))
+	}
+
+	if s.Reset() != s {
+		t.Error("Returned KLLSketch should be the same instance")
+	}
+
+	if count := s.Count(); count != 0 {
+		t.Errorf("expected 0, got %d", count)
+	}
+
+	if len(s.levels) != 1 || len(s.levels[0]) != 0 {
+		t.Error("expected empty levels")
+	}
+}
+
+// Ensures that KLLSketch can be serialized and deserialized without errors.
+func TestKLLSerialization(t *testing.T) {
+	s := NewDefaultKLLSketch()
+	for i := 0; i < 10000; i++ {
+		s.Update(float64(i))
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(s); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &KLLSketch{}
+	if err := gob.NewDecoder(&buf).Decode(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, q := range []float64{0, 0.01, 0.5, 0.99, 1} {
+		if expected, actual := s.Quantile(q), decoded.Quantile(q); expected != actual {
+			t.Errorf("expected %f, got %f", expected, actual)
+		}
+	}
+
+	if count := decoded.Count(); count != 10000 {
+		t.Errorf("expected 10000, got %d", count)
+	}
+
+	decoded.Update(10000)
+	if err := decoded.Merge(s); err != nil {
+		t.Error(err)
+	}
+}
+
+func BenchmarkKLLUpdate(b *testing.B) {
+	s := NewDefaultKLLSketch()
+	r := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		s.Update(r.Float64())
+	}
+}
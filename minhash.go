@@ -3,6 +3,7 @@ package boom
 import (
 	"math"
 	"math/rand"
+	"sort"
 )
 
 // MinHash is a variation of the technique for estimating similarity between
@@ -14,28 +15,42 @@ import (
 // This can be used to cluster or compare documents by splitting the corpus
 // into a bag of words. MinHash returns the approximated similarity ratio of
 // the two bags. The similarity is less accurate for very small bags of words.
+// The hash parameters are drawn from the global math/rand source.
 func MinHash(bag1, bag2 []string) float32 {
+	return minHashSimilarity(bag1, bag2, &randGen{})
+}
+
+// MinHashWithSource is equivalent to MinHash but draws the hash parameters
+// from the given source, so the same bags and seed always produce the same
+// similarity.
+func MinHashWithSource(bag1, bag2 []string, src rand.Source) float32 {
+	r := &randGen{}
+	r.setSource(src)
+	return minHashSimilarity(bag1, bag2, r)
+}
+
+func minHashSimilarity(bag1, bag2 []string, r *randGen) float32 {
 	k := len(bag1) + len(bag2)
 	hashes := make([]int, k)
 	for i := 0; i < k; i++ {
-		a := uint(rand.Int())
-		b := uint(rand.Int())
-		c := uint(rand.Int())
+		a := uint(r.Int())
+		b := uint(r.Int())
+		c := uint(r.Int())
 		x := computeHash(a*b*c, a, b, c)
 		hashes[i] = int(x)
 	}
 
-	bitMap := bitMap(bag1, bag2)
+	elements := sortedElements(bitMap(bag1, bag2))
 	minHashValues := hashBuckets(2, k)
-	minHash(bag1, 0, minHashValues, bitMap, k, hashes)
-	minHash(bag2, 1, minHashValues, bitMap, k, hashes)
+	minHash(bag1, 0, minHashValues, elements, k, hashes)
+	minHash(bag2, 1, minHashValues, elements, k, hashes)
 	return similarity(minHashValues, k)
 }
 
 func minHash(bag []string, bagIndex int, minHashValues [][]int,
-	bitArray map[string][]bool, k int, hashes []int) {
+	elements []string, k int, hashes []int) {
 	index := 0
-	for element := range bitArray {
+	for _, element := range elements {
 		for i := 0; i < k; i++ {
 			if contains(bag, element) {
 				hindex := hashes[index]
@@ -74,6 +89,17 @@ func bitMap(bag1, bag2 []string) map[string][]bool {
 	return bitArray
 }
 
+// sortedElements returns the distinct elements of both bags in a fixed order,
+// so each element is assigned the same hash for both bags.
+func sortedElements(bitArray map[string][]bool) []string {
+	elements := make([]string, 0, len(bitArray))
+	for element := range bitArray {
+		elements = append(elements, element)
+	}
+	sort.Strings(elements)
+	return elements
+}
+
 func hashBuckets(numSets, k int) [][]int {
 	minHashValues := make([][]int, numSets)
 	for i := 0; i < numSets; i++ {
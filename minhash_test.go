@@ -36,6 +36,23 @@ func TestMinHash(t *testing.T) {
 	}
 }
 
+// Ensures that MinHashWithSource returns the same similarity for the same
+// seed.
+func TestMinHashWithSource(t *testing.T) {
+	dict := dictionary(1000)
+	bag := dictionary(500)
+
+	s1 := MinHashWithSource(dict, bag, NewRandSource(42))
+	s2 := MinHashWithSource(dict, bag, NewRandSource(42))
+	if s1 != s2 {
+		t.Errorf("Expected %f, got %f", s1, s2)
+	}
+
+	if s1 > 0.7 || s1 < 0.5 {
+		t.Errorf("Expected between 0.5 and 0.7, got %f", s1)
+	}
+}
+
 func BenchmarkMinHash(b *testing.B) {
 	b.StopTimer()
 	bag1 := dictionary(500)
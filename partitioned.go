@@ -18,6 +18,7 @@ package boom
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"hash"
 	"hash/fnv"
 	"io"
@@ -156,9 +157,140 @@ func (p *PartitionedBloomFilter) Reset() *PartitionedBloomFilter {
 	for _, partition := range p.partitions {
 		partition.Reset()
 	}
+	p.count = 0
 	return p
 }
 
+// Union returns a new partitioned Bloom filter containing the elements of both
+// filters, leaving them unchanged. Returns an error if the filters don't have
+// the same size and number of hash functions, or don't use the same hash
+// function.
+func (p *PartitionedBloomFilter) Union(other *PartitionedBloomFilter) (*PartitionedBloomFilter, error) {
+	union := p.clone()
+	if err := union.UnionInPlace(other); err != nil {
+		return nil, err
+	}
+	return union, nil
+}
+
+// UnionInPlace adds the elements of another partitioned Bloom filter to this
+// one by setting each bit set in either filter. The count becomes the
+// estimated cardinality of the union. Returns an error if the filters don't
+// have the same size and number of hash functions, or don't use the same hash
+// function.
+func (p *PartitionedBloomFilter) UnionInPlace(other *PartitionedBloomFilter) error {
+	if err := p.compatible(other); err != nil {
+		return err
+	}
+
+	for i, partition := range p.partitions {
+		partition.or(other.partitions[i])
+	}
+	p.count = uint(p.cardinality() + 0.5)
+	return nil
+}
+
+// Intersect returns a new partitioned Bloom filter containing the elements
+// common to both filters, leaving them unchanged. Returns an error if the
+// filters don't have the same size and number of hash functions, or don't use
+// the same hash function.
+func (p *PartitionedBloomFilter) Intersect(other *PartitionedBloomFilter) (*PartitionedBloomFilter, error) {
+	intersection := p.clone()
+	if err := intersection.IntersectInPlace(other); err != nil {
+		return nil, err
+	}
+	return intersection, nil
+}
+
+// IntersectInPlace keeps only the elements of this partitioned Bloom filter
+// which are also in another one by clearing each bit not set in both filters.
+// The intersection has a higher false-positive rate than a filter built from
+// the common elements, since bits set by different elements in each filter
+// remain set. The count becomes the estimated cardinality of the
+// intersection. Returns an error if the filters don't have the same size and
+// number of hash functions, or don't use the same hash function.
+func (p *PartitionedBloomFilter) IntersectInPlace(other *PartitionedBloomFilter) error {
+	count, err := p.IntersectionCount(other)
+	if err != nil {
+		return err
+	}
+
+	for i, partition := range p.partitions {
+		partition.and(other.partitions[i])
+	}
+	p.count = uint(count)
+	return nil
+}
+
+// UnionCount returns the estimated number of distinct elements in either
+// filter, based on the number of bits set in either filter. Returns an error
+// if the filters don't have the same size and number of hash functions, or
+// don't use the same hash function.
+func (p *PartitionedBloomFilter) UnionCount(other *PartitionedBloomFilter) (uint64, error) {
+	union, err := p.Union(other)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(union.cardinality() + 0.5), nil
+}
+
+// IntersectionCount returns the estimated number of distinct elements in both
+// filters using the inclusion-exclusion principle, |A∩B| = |A| + |B| -
+// |A∪B|, with each cardinality estimated from the number of set bits. Returns
+// an error if the filters don't have the same size and number of hash
+// functions, or don't use the same hash function.
+func (p *PartitionedBloomFilter) IntersectionCount(other *PartitionedBloomFilter) (uint64, error) {
+	union, err := p.Union(other)
+	if err != nil {
+		return 0, err
+	}
+
+	count := p.cardinality() + other.cardinality() - union.cardinality()
+	if count < 0 {
+		return 0, nil
+	}
+	return uint64(count + 0.5), nil
+}
+
+// cardinality returns the estimated number of distinct elements in the filter
+// averaged over the partitions, each of which has a single bit set per
+// element.
+func (p *PartitionedBloomFilter) cardinality() float64 {
+	sum := float64(0)
+	for _, partition := range p.partitions {
+		sum += bloomCardinality(partition.ones(), p.s, 1)
+	}
+	return sum / float64(p.k)
+}
+
+// clone returns a copy of the filter which uses the same hash function.
+func (p *PartitionedBloomFilter) clone() *PartitionedBloomFilter {
+	clone := *p
+	clone.partitions = make([]*Buckets, len(p.partitions))
+	for i, partition := range p.partitions {
+		clone.partitions[i] = partition.clone()
+	}
+	return &clone
+}
+
+// compatible returns an error if the filters don't have the same size and
+// number of hash functions, or don't use the same hash function.
+func (p *PartitionedBloomFilter) compatible(other *PartitionedBloomFilter) error {
+	if p.m != other.m {
+		return errors.New("filter size must match")
+	}
+
+	if p.k != other.k {
+		return errors.New("number of hash functions must match")
+	}
+
+	if !sameHash(p.hash, other.hash) {
+		return errors.New("hash functions must match")
+	}
+
+	return nil
+}
+
 // SetHash sets the hashing function used in the filter.
 // For the effect on false positive rates see: https://github.com/tylertreat/BoomFilters/pull/1
 func (p *PartitionedBloomFilter) SetHash(h hash.Hash64) {
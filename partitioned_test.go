@@ -3,6 +3,7 @@ package boom
 import (
 	"bytes"
 	"encoding/gob"
+	"hash/fnv"
 	"strconv"
 	"testing"
 
@@ -134,6 +135,10 @@ func TestPartitionedBloomReset(t *testing.T) {
 			}
 		}
 	}
+
+	if count := f.Count(); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
 }
 
 // Ensures that PartitionedBloomFilter can be serialized and deserialized without errors.
@@ -158,6 +163,122 @@ func TestPartitionedBloomGob(t *testing.T) {
 	}
 }
 
+// Ensures that Union and UnionInPlace combine the elements of both filters
+// and estimate the cardinality of the union.
+func TestPartitionedBloomUnion(t *testing.T) {
+	f1 := NewPartitionedBloomFilter(1000, 0.01)
+	f2 := NewPartitionedBloomFilter(1000, 0.01)
+	for i := 0; i < 600; i++ {
+		f1.Add([]byte(strconv.Itoa(i)))
+	}
+	for i := 400; i < 1000; i++ {
+		f2.Add([]byte(strconv.Itoa(i)))
+	}
+
+	count, err := f1.UnionCount(f2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count < 950 || count > 1050 {
+		t.Errorf("Expected around 1000, got %d", count)
+	}
+
+	union, err := f1.Union(f2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f1.Test([]byte(`999`)) {
+		t.Error("Union should leave the filter unchanged")
+	}
+
+	if err := f1.UnionInPlace(f2); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []*PartitionedBloomFilter{union, f1} {
+		for i := 0; i < 1000; i++ {
+			if !f.Test([]byte(strconv.Itoa(i))) {
+				t.Errorf("Expected %d to be a member", i)
+			}
+		}
+
+		if f.Count() != uint(count) {
+			t.Errorf("Expected %d, got %d", count, f.Count())
+		}
+	}
+
+	if _, err := f1.Union(NewPartitionedBloomFilter(100, 0.01)); err == nil {
+		t.Error("Expected error for different size")
+	}
+
+	other := NewPartitionedBloomFilter(1000, 0.01)
+	other.SetHash(fnv.New64a())
+	if err := f1.UnionInPlace(other); err == nil {
+		t.Error("Expected error for different hash function")
+	}
+}
+
+// Ensures that Intersect and IntersectInPlace keep the elements common to
+// both filters and estimate the cardinality of the intersection.
+func TestPartitionedBloomIntersect(t *testing.T) {
+	f1 := NewPartitionedBloomFilter(1000, 0.01)
+	f2 := NewPartitionedBloomFilter(1000, 0.01)
+	for i := 0; i < 600; i++ {
+		f1.Add([]byte(strconv.Itoa(i)))
+	}
+	for i := 400; i < 1000; i++ {
+		f2.Add([]byte(strconv.Itoa(i)))
+	}
+
+	count, err := f1.IntersectionCount(f2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count < 150 || count > 250 {
+		t.Errorf("Expected around 200, got %d", count)
+	}
+
+	intersection, err := f1.Intersect(f2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !f1.Test([]byte(`0`)) {
+		t.Error("Intersect should leave the filter unchanged")
+	}
+
+	if err := f1.IntersectInPlace(f2); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []*PartitionedBloomFilter{intersection, f1} {
+		for i := 400; i < 600; i++ {
+			if !f.Test([]byte(strconv.Itoa(i))) {
+				t.Errorf("Expected %d to be a member", i)
+			}
+		}
+
+		members := 0
+		for i := 0; i < 400; i++ {
+			if f.Test([]byte(strconv.Itoa(i))) {
+				members++
+			}
+		}
+		if members > 40 {
+			t.Errorf("Expected few elements of only one filter to be members, got %d", members)
+		}
+
+		if f.Count() != uint(count) {
+			t.Errorf("Expected %d, got %d", count, f.Count())
+		}
+	}
+
+	if _, err := f1.Intersect(NewPartitionedBloomFilter(1000, 0.1)); err == nil {
+		t.Error("Expected error for different parameters")
+	}
+}
+
 func BenchmarkPartitionedBloomAdd(b *testing.B) {
 	b.StopTimer()
 	f := NewPartitionedBloomFilter(100000, 0.1)
@@ -199,3 +320,17 @@ func BenchmarkPartitionedBloomTestAndAdd(b *testing.B) {
 		f.TestAndAdd(data[n])
 	}
 }
+
+func BenchmarkPartitionedBloomUnion(b *testing.B) {
+	b.StopTimer()
+	f1 := NewPartitionedBloomFilter(100000, 0.1)
+	f2 := NewPartitionedBloomFilter(100000, 0.1)
+	for i := 0; i < 100000; i++ {
+		f2.Add([]byte(strconv.Itoa(i)))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f1.UnionInPlace(f2)
+	}
+}
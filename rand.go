@@ -0,0 +1,130 @@
+package boom
+
+import (
+	"encoding/binary"
+	"io"
+	"math/rand"
+)
+
+// randSource is a splitmix64 pseudo-random source. Unlike the sources provided
+// by math/rand, its state is a single word, so it can be persisted along with
+// the structures which use it.
+type randSource struct {
+	state uint64
+}
+
+// NewRandSource returns a new pseudo-random source seeded with the given
+// value. Structures using a source created this way produce identical state
+// for identical input, and the source's state is persisted by WriteTo and
+// restored by ReadFrom so that a restored structure continues the same
+// sequence.
+func NewRandSource(seed int64) rand.Source {
+	return &randSource{state: uint64(seed)}
+}
+
+// Seed uses the provided seed value to initialize the source to a
+// deterministic state.
+func (r *randSource) Seed(seed int64) {
+	r.state = uint64(seed)
+}
+
+// Uint64 returns a pseudo-random 64-bit value.
+func (r *randSource) Uint64() uint64 {
+	r.state += 0x9e3779b97f4a7c15
+	z := r.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Int63 returns a non-negative pseudo-random 63-bit integer.
+func (r *randSource) Int63() int64 {
+	return int64(r.Uint64() >> 1)
+}
+
+// randGen generates random numbers from an optional source, falling back to
+// the global math/rand source if none is set.
+type randGen struct {
+	source rand.Source // source set by the user, if any
+	rand   *rand.Rand  // generator using source
+}
+
+// setSource sets the source used to generate random numbers.
+func (g *randGen) setSource(src rand.Source) {
+	g.source = src
+	g.rand = nil
+	if src != nil {
+		g.rand = rand.New(src)
+	}
+}
+
+// Intn returns a non-negative pseudo-random number in [0, n).
+func (g *randGen) Intn(n int) int {
+	if g.rand == nil {
+		return rand.Intn(n)
+	}
+	return g.rand.Intn(n)
+}
+
+// Float64 returns a pseudo-random number in [0.0, 1.0).
+func (g *randGen) Float64() float64 {
+	if g.rand == nil {
+		return rand.Float64()
+	}
+	return g.rand.Float64()
+}
+
+// Int returns a non-negative pseudo-random int.
+func (g *randGen) Int() int {
+	if g.rand == nil {
+		return rand.Int()
+	}
+	return g.rand.Int()
+}
+
+// WriteTo writes the state of the source to an i/o stream if it was created
+// by NewRandSource. Otherwise, only a flag indicating there is no state is
+// written. It returns the number of bytes written.
+func (g *randGen) WriteTo(stream io.Writer) (int64, error) {
+	var (
+		persisted uint8
+		state     uint64
+	)
+	if src, ok := g.source.(*randSource); ok {
+		persisted = 1
+		state = src.state
+	}
+
+	err := binary.Write(stream, binary.BigEndian, persisted)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, state)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.Size(uint8(0)) + binary.Size(uint64(0))), nil
+}
+
+// ReadFrom reads the state of the source (such as might have been written by
+// WriteTo()) from an i/o stream. If no state was persisted, the current
+// source is kept. It returns the number of bytes read.
+func (g *randGen) ReadFrom(stream io.Reader) (int64, error) {
+	var (
+		persisted uint8
+		state     uint64
+	)
+	err := binary.Read(stream, binary.BigEndian, &persisted)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &state)
+	if err != nil {
+		return 0, err
+	}
+
+	if persisted == 1 {
+		g.setSource(&randSource{state: state})
+	}
+	return int64(binary.Size(uint8(0)) + binary.Size(uint64(0))), nil
+}
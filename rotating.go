@@ -0,0 +1,321 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"io"
+	"time"
+)
+
+// RotatingBloomFilter implements a generational Bloom filter for
+// deduplicating elements within a time-to-live. It's composed of a ring of
+// classic Bloom filters, one per generation. Elements are added to the current
+// generation and tested against all generations. When the current generation
+// has been live for the rotation interval, or has reached its capacity for
+// count-based filters, the oldest generation is cleared and becomes the
+// current one.
+//
+// An element remains a member for at least generations-1 rotations after it
+// was added, so a timed filter with g generations and interval i has no false
+// negatives for elements added within the last (g-1)*i. Since elements are
+// tested against every generation, each generation is sized for a fraction of
+// the target false-positive rate.
+type RotatingBloomFilter struct {
+	generations []*BloomFilter   // ring of generations
+	current     uint             // index of the current generation
+	n           uint             // capacity of each generation
+	fpRate      float64          // target false-positive rate
+	interval    time.Duration    // rotation interval, zero if count-based
+	rotated     time.Time        // time of the last rotation
+	clock       func() time.Time // current time
+}
+
+// NewRotatingBloomFilter creates a new RotatingBloomFilter with the given
+// number of generations, which rotates after every n elements added, with the
+// specified target false-positive rate.
+func NewRotatingBloomFilter(generations, n uint, fpRate float64) *RotatingBloomFilter {
+	return newRotatingBloomFilter(generations, n, fpRate, 0)
+}
+
+// NewTimedRotatingBloomFilter creates a new RotatingBloomFilter with the given
+// number of generations, which rotates every interval, with the specified
+// target false-positive rate, assuming no more than n elements are added per
+// interval.
+func NewTimedRotatingBloomFilter(generations uint, interval time.Duration, n uint,
+	fpRate float64) *RotatingBloomFilter {
+	return newRotatingBloomFilter(generations, n, fpRate, interval)
+}
+
+// newRotatingBloomFilter creates a new RotatingBloomFilter whose generations
+// each hold n elements. If interval is non-zero, generations rotate on time
+// rather than on insertions.
+func newRotatingBloomFilter(generations, n uint, fpRate float64,
+	interval time.Duration) *RotatingBloomFilter {
+	if generations < 2 {
+		generations = 2
+	}
+
+	filters := make([]*BloomFilter, generations)
+	for i := range filters {
+		filters[i] = NewBloomFilter(n, fpRate/float64(generations))
+	}
+
+	return &RotatingBloomFilter{
+		generations: filters,
+		n:           n,
+		fpRate:      fpRate,
+		interval:    interval,
+		rotated:     time.Now(),
+		clock:       time.Now,
+	}
+}
+
+// Generations returns the number of generations.
+func (r *RotatingBloomFilter) Generations() uint {
+	return uint(len(r.generations))
+}
+
+// Interval returns the rotation interval, or zero if generations rotate on
+// insertions.
+func (r *RotatingBloomFilter) Interval() time.Duration {
+	return r.interval
+}
+
+// Capacity returns the number of elements each generation holds.
+func (r *RotatingBloomFilter) Capacity() uint {
+	return r.n
+}
+
+// Count returns the number of elements added to the current generation.
+func (r *RotatingBloomFilter) Count() uint {
+	r.advance()
+	return r.generations[r.current].Count()
+}
+
+// FillRatio returns the ratio of set bits in the current generation.
+func (r *RotatingBloomFilter) FillRatio() float64 {
+	r.advance()
+	return r.generations[r.current].FillRatio()
+}
+
+// EstimatedFillRatio returns the estimated ratio of set bits in the current
+// generation.
+func (r *RotatingBloomFilter) EstimatedFillRatio() float64 {
+	r.advance()
+	return r.generations[r.current].EstimatedFillRatio()
+}
+
+// Test will test for membership of the data in any generation and returns
+// true if it is a member, false if not. This is a probabilistic test, meaning
+// there is a non-zero probability of false positives. There are no false
+// negatives for elements added within the last generations-1 rotations. For
+// timed filters, any elapsed rotations are performed first.
+func (r *RotatingBloomFilter) Test(data []byte) bool {
+	r.advance()
+	for _, generation := range r.generations {
+		if generation.Test(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add will add the data to the current generation. It returns the filter to
+// allow for chaining.
+func (r *RotatingBloomFilter) Add(data []byte) Filter {
+	r.advance()
+	r.generations[r.current].Add(data)
+	return r
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not.
+func (r *RotatingBloomFilter) TestAndAdd(data []byte) bool {
+	member := r.Test(data)
+	r.generations[r.current].Add(data)
+	return member
+}
+
+// Rotate clears the oldest generation and makes it the current one. It returns
+// the filter to allow for chaining.
+func (r *RotatingBloomFilter) Rotate() *RotatingBloomFilter {
+	r.rotate()
+	r.rotated = r.clock()
+	return r
+}
+
+// Reset restores the filter to its original state. It returns the filter to
+// allow for chaining.
+func (r *RotatingBloomFilter) Reset() *RotatingBloomFilter {
+	for _, generation := range r.generations {
+		generation.Reset()
+	}
+	r.current = 0
+	r.rotated = r.clock()
+	return r
+}
+
+// SetHash sets the hashing function used in the filter.
+// For the effect on false positive rates see: https://github.com/tylertreat/BoomFilters/pull/1
+func (r *RotatingBloomFilter) SetHash(h hash.Hash64) {
+	for _, generation := range r.generations {
+		generation.SetHash(h)
+	}
+}
+
+// SetClock sets the function used to get the current time for timed filters,
+// which defaults to time.Now. The current generation starts at the clock's
+// current time, so it should be set before any data is added.
+func (r *RotatingBloomFilter) SetClock(clock func() time.Time) {
+	r.clock = clock
+	r.rotated = clock()
+}
+
+// advance rotates once for each interval which has elapsed for a timed filter,
+// or if the current generation is full for a count-based filter.
+func (r *RotatingBloomFilter) advance() {
+	if r.interval == 0 {
+		if r.generations[r.current].Count() >= r.n {
+			r.rotate()
+		}
+		return
+	}
+
+	elapsed := r.clock().Sub(r.rotated)
+	if elapsed < r.interval {
+		return
+	}
+
+	rotations := elapsed / r.interval
+	r.rotated = r.rotated.Add(rotations * r.interval)
+	if rotations > time.Duration(len(r.generations)) {
+		rotations = time.Duration(len(r.generations))
+	}
+	for i := time.Duration(0); i < rotations; i++ {
+		r.rotate()
+	}
+}
+
+// rotate clears the oldest generation and makes it the current one.
+func (r *RotatingBloomFilter) rotate() {
+	r.current = (r.current + 1) % uint(len(r.generations))
+	r.generations[r.current].Reset()
+}
+
+// WriteTo writes a binary representation of the RotatingBloomFilter to an i/o
+// stream. It returns the number of bytes written.
+func (r *RotatingBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, uint64(len(r.generations)))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(r.current))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(r.n))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, r.fpRate)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, int64(r.interval))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, r.rotated.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	numBytes := int64(6 * binary.Size(uint64(0)))
+	for _, generation := range r.generations {
+		num, err := generation.WriteTo(stream)
+		if err != nil {
+			return 0, err
+		}
+		numBytes += num
+	}
+	return numBytes, nil
+}
+
+// ReadFrom reads a binary representation of RotatingBloomFilter (such as might
+// have been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (r *RotatingBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	// Every generation keeps the hash of the current generations, if any.
+	var h hash.Hash64
+	if len(r.generations) > 0 {
+		h = r.generations[0].hash
+	}
+	var len, current, n uint64
+	var fpRate float64
+	var interval, rotated int64
+	err := binary.Read(stream, binary.BigEndian, &len)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &current)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &n)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &fpRate)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &interval)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &rotated)
+	if err != nil {
+		return 0, err
+	}
+	numBytes := int64(6 * binary.Size(uint64(0)))
+	generations := make([]*BloomFilter, len)
+	for i := range generations {
+		generation := &BloomFilter{hash: h}
+		num, err := generation.ReadFrom(stream)
+		if err != nil {
+			return 0, err
+		}
+		numBytes += num
+		generations[i] = generation
+	}
+
+	r.generations = generations
+	r.current = uint(current)
+	r.n = uint(n)
+	r.fpRate = fpRate
+	r.interval = time.Duration(interval)
+	r.rotated = time.Unix(0, rotated)
+	if r.clock == nil {
+		r.clock = time.Now
+	}
+	return numBytes, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (r *RotatingBloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := r.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (r *RotatingBloomFilter) GobDecode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := r.ReadFrom(buf)
+
+	return err
+}
@@ -0,0 +1,262 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/gob"
+	"hash/fnv"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Ensures that a count-based filter rotates after every n elements and
+// elements remain members for generations-1 rotations.
+func TestRotatingBloomCount(t *testing.T) {
+	f := NewRotatingBloomFilter(3, 100, 0.01)
+
+	if generations := f.Generations(); generations != 3 {
+		t.Errorf("Expected 3, got %d", generations)
+	}
+
+	if capacity := f.Capacity(); capacity != 100 {
+		t.Errorf("Expected 100, got %d", capacity)
+	}
+
+	for i := 0; i < 250; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if count := f.Count(); count != 50 {
+		t.Errorf("Expected 50, got %d", count)
+	}
+
+	if ratio := f.FillRatio(); ratio <= 0 || ratio > 0.5 {
+		t.Errorf("Expected fill ratio in (0, 0.5], got %f", ratio)
+	}
+
+	for i := 0; i < 250; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+
+	for i := 250; i < 300; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+	f.Add([]byte(`300`))
+
+	// The first generation, 0 through 99, has been rotated out.
+	members := 0
+	for i := 0; i < 100; i++ {
+		if f.Test([]byte(strconv.Itoa(i))) {
+			members++
+		}
+	}
+	if members > 5 {
+		t.Errorf("Expected at most 5 false positives, got %d", members)
+	}
+
+	for i := 100; i <= 300; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+}
+
+// Ensures that a timed filter rotates every interval and evicts elements once
+// all generations have rotated.
+func TestRotatingBloomTimed(t *testing.T) {
+	clock := newTestClock()
+	f := NewTimedRotatingBloomFilter(3, time.Minute, 100, 0.01)
+	f.SetClock(clock.Now)
+
+	if interval := f.Interval(); interval != time.Minute {
+		t.Errorf("Expected 1m0s, got %s", interval)
+	}
+
+	f.Add([]byte(`a`))
+	clock.Advance(90 * time.Second)
+	f.Add([]byte(`b`))
+
+	if count := f.Count(); count != 1 {
+		t.Errorf("Expected 1, got %d", count)
+	}
+
+	clock.Advance(60 * time.Second)
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	clock.Advance(30 * time.Second)
+	if f.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+	if !f.Test([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+
+	clock.Advance(time.Hour)
+	if f.Test([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+}
+
+// Ensures that TestAndAdd and Rotate behave correctly.
+func TestRotatingBloomTestAndAdd(t *testing.T) {
+	f := NewRotatingBloomFilter(2, 100, 0.01)
+
+	if f.TestAndAdd([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+
+	if f.Rotate() != f {
+		t.Error("Returned RotatingBloomFilter should be the same instance")
+	}
+
+	if !f.TestAndAdd([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	f.Rotate()
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	f.Rotate()
+	if f.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+}
+
+// Ensures that Reset clears all generations.
+func TestRotatingBloomReset(t *testing.T) {
+	f := NewRotatingBloomFilter(3, 100, 0.01)
+	for i := 0; i < 250; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if f.Reset() != f {
+		t.Error("Returned RotatingBloomFilter should be the same instance")
+	}
+
+	for i, generation := range f.generations {
+		if count := generation.Count(); count != 0 {
+			t.Errorf("Expected 0 in generation %d, got %d", i, count)
+		}
+		if ratio := generation.FillRatio(); ratio != 0 {
+			t.Errorf("Expected 0 in generation %d, got %f", i, ratio)
+		}
+	}
+}
+
+// Ensures that the filter can be serialized mid-rotation and resumed.
+func TestRotatingBloomSerialization(t *testing.T) {
+	clock := newTestClock()
+	f := NewTimedRotatingBloomFilter(3, time.Minute, 100, 0.01)
+	f.SetClock(clock.Now)
+	f.Add([]byte(`a`))
+	clock.Advance(90 * time.Second)
+	f.Add([]byte(`b`))
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(f); err != nil {
+		t.Fatal(err)
+	}
+
+	wn, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &RotatingBloomFilter{}
+	if err := gob.NewDecoder(&buf).Decode(decoded); err != nil {
+		t.Fatal(err)
+	}
+	decoded.clock = clock.Now
+
+	read := NewRotatingBloomFilter(2, 10, 0.1)
+	read.clock = clock.Now
+	rn, err := read.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wn != rn {
+		t.Errorf("Expected %d bytes read, got %d", wn, rn)
+	}
+
+	for _, filter := range []*RotatingBloomFilter{decoded, read} {
+		if count := filter.Count(); count != 1 {
+			t.Errorf("Expected 1, got %d", count)
+		}
+
+		if !filter.Test([]byte(`a`)) || !filter.Test([]byte(`b`)) {
+			t.Error("`a` and `b` should be members")
+		}
+
+		// The rotation schedule continues where it left off.
+		clock.Advance(90 * time.Second)
+		if filter.Test([]byte(`a`)) {
+			t.Error("`a` should not be a member")
+		}
+		if !filter.Test([]byte(`b`)) {
+			t.Error("`b` should be a member")
+		}
+		clock.Advance(-90 * time.Second)
+	}
+}
+
+// Ensures that a filter with a custom hash can be resumed by a filter using the
+// same hash, which then applies to every generation.
+func TestRotatingBloomSerializationCustomHash(t *testing.T) {
+	f := NewRotatingBloomFilter(3, 200, 0.01)
+	f.SetHash(fnv.New64a())
+	for i := 0; i < 500; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	read := NewRotatingBloomFilter(2, 10, 0.1)
+	read.SetHash(fnv.New64a())
+	if _, err := read.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 100; i < 500; i++ {
+		if !read.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+}
+
+func BenchmarkRotatingBloomAdd(b *testing.B) {
+	b.StopTimer()
+	f := NewRotatingBloomFilter(3, 100000, 0.01)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
+
+func BenchmarkRotatingBloomTest(b *testing.B) {
+	b.StopTimer()
+	f := NewRotatingBloomFilter(3, 100000, 0.01)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Test(data[n])
+	}
+}
@@ -0,0 +1,290 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"io"
+	"math"
+	"math/rand"
+)
+
+// scalableCuckooGrowth is the factor by which the capacity of each sub-filter
+// grows over the previous one.
+const scalableCuckooGrowth = 2
+
+// ScalableCuckooFilter implements a Cuckoo Filter which dynamically adapts to
+// the number of elements in the data set. It applies the approach of Scalable
+// Bloom Filters to Cuckoo Filters: once the newest sub-filter reaches its
+// capacity, a new sub-filter with twice the capacity and a tighter
+// false-positive rate is added. Sub-filter i targets fp*(1-r)*r^i, where r is
+// the tightening ratio, so the compounded false-positive rate over the whole
+// series is bounded by fp, even accounting for an infinite series.
+//
+// Like the Cuckoo Filter, elements can be removed. Data is tested and removed
+// across every sub-filter, so elements remain removable after the filter has
+// grown.
+type ScalableCuckooFilter struct {
+	filters []*CuckooFilter // filters with growing capacities and decreasing error rates
+	r       float64         // tightening ratio
+	fp      float64         // target false-positive rate
+	hint    uint            // capacity of the first filter
+	rand    randGen         // source of entries to relocate, shared by every filter
+}
+
+// NewScalableCuckooFilter creates a new Scalable Cuckoo Filter whose first
+// sub-filter stores hint items, with the specified target false-positive rate
+// and tightening ratio. Use NewDefaultScalableCuckooFilter if you don't want
+// to calculate these parameters.
+func NewScalableCuckooFilter(hint uint, fpRate, r float64) *ScalableCuckooFilter {
+	s := &ScalableCuckooFilter{
+		filters: make([]*CuckooFilter, 0, 1),
+		r:       r,
+		fp:      fpRate,
+		hint:    hint,
+	}
+
+	s.addFilter()
+	return s
+}
+
+// NewDefaultScalableCuckooFilter creates a new Scalable Cuckoo Filter with the
+// specified target false-positive rate and an optimal tightening ratio.
+func NewDefaultScalableCuckooFilter(fpRate float64) *ScalableCuckooFilter {
+	return NewScalableCuckooFilter(10000, fpRate, 0.8)
+}
+
+// Capacity returns the current Scalable Cuckoo Filter capacity, which is the
+// sum of the capacities for the contained series of Cuckoo Filters.
+func (s *ScalableCuckooFilter) Capacity() uint {
+	capacity := uint(0)
+	for _, filter := range s.filters {
+		capacity += filter.Capacity()
+	}
+	return capacity
+}
+
+// Count returns the number of items in the filter.
+func (s *ScalableCuckooFilter) Count() uint {
+	count := uint(0)
+	for _, filter := range s.filters {
+		count += filter.Count()
+	}
+	return count
+}
+
+// Filters returns the number of sub-filters.
+func (s *ScalableCuckooFilter) Filters() uint {
+	return uint(len(s.filters))
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives.
+func (s *ScalableCuckooFilter) Test(data []byte) bool {
+	for _, filter := range s.filters {
+		if filter.Test(data) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Add will add the data to the newest sub-filter, adding a new sub-filter
+// first if it has reached its capacity. Since sub-filters are added well
+// before they fill up, an error is only returned in the unlikely event that
+// the data can't be inserted into a new, empty sub-filter either.
+func (s *ScalableCuckooFilter) Add(data []byte) error {
+	idx := len(s.filters) - 1
+
+	// If the last filter has reached its capacity, add a new one.
+	if s.filters[idx].Count() >= s.filters[idx].Capacity() {
+		s.addFilter()
+		idx++
+	}
+
+	if err := s.filters[idx].Add(data); err == nil {
+		return nil
+	}
+
+	s.addFilter()
+	return s.filters[idx+1].Add(data)
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not. An error is returned if the data isn't a
+// member and couldn't be added.
+func (s *ScalableCuckooFilter) TestAndAdd(data []byte) (bool, error) {
+	if s.Test(data) {
+		return true, nil
+	}
+
+	return false, s.Add(data)
+}
+
+// TestAndRemove will test for membership of the data and remove it from the
+// sub-filter containing it. Returns true if the data was a member, false if
+// not.
+func (s *ScalableCuckooFilter) TestAndRemove(data []byte) bool {
+	for _, filter := range s.filters {
+		if filter.TestAndRemove(data) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reset restores the filter to its original state. It returns the filter to
+// allow for chaining.
+func (s *ScalableCuckooFilter) Reset() *ScalableCuckooFilter {
+	hash := s.filters[0].hash
+	s.filters = make([]*CuckooFilter, 0, 1)
+	s.addFilter()
+	s.filters[0].SetHash(hash)
+	return s
+}
+
+// addFilter adds a new Cuckoo Filter with a larger capacity and a restricted
+// false-positive rate to the Scalable Cuckoo Filter.
+func (s *ScalableCuckooFilter) addFilter() {
+	var (
+		i      = float64(len(s.filters))
+		n      = uint(float64(s.hint) * math.Pow(scalableCuckooGrowth, i))
+		fpRate = s.fp * (1 - s.r) * math.Pow(s.r, i)
+		c      = NewCuckooFilter(n, fpRate)
+	)
+	if len(s.filters) > 0 {
+		c.SetHash(s.filters[0].hash)
+	}
+	c.SetRandSource(s.rand.source)
+	s.filters = append(s.filters, c)
+}
+
+// SetHash sets the hashing function used in the filter.
+// For the effect on false positive rates see: https://github.com/tylertreat/BoomFilters/pull/1
+func (s *ScalableCuckooFilter) SetHash(h hash.Hash32) {
+	for _, filter := range s.filters {
+		filter.SetHash(h)
+	}
+}
+
+// SetRandSource sets the source used to pick the entries to relocate when
+// inserting into full buckets, which defaults to the global math/rand source.
+// Filters using the same seeded source end up in identical states for
+// identical input. The state of a source created with NewRandSource is
+// persisted by WriteTo.
+func (s *ScalableCuckooFilter) SetRandSource(src rand.Source) {
+	s.rand.setSource(src)
+	for _, filter := range s.filters {
+		filter.SetRandSource(src)
+	}
+}
+
+// WriteTo writes a binary representation of the ScalableCuckooFilter to an
+// i/o stream. It returns the number of bytes written.
+func (s *ScalableCuckooFilter) WriteTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, s.r)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, s.fp)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(s.hint))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(len(s.filters)))
+	if err != nil {
+		return 0, err
+	}
+	numBytes := int64(4 * binary.Size(uint64(0)))
+	for _, filter := range s.filters {
+		num, err := filter.WriteTo(stream)
+		if err != nil {
+			return 0, err
+		}
+		numBytes += num
+	}
+	num, err := s.rand.WriteTo(stream)
+	if err != nil {
+		return 0, err
+	}
+	return numBytes + num, nil
+}
+
+// ReadFrom reads a binary representation of ScalableCuckooFilter (such as
+// might have been written by WriteTo()) from an i/o stream. It returns the
+// number of bytes read.
+func (s *ScalableCuckooFilter) ReadFrom(stream io.Reader) (int64, error) {
+	// Every sub-filter keeps the hash of the current filters, if any.
+	var h hash.Hash32
+	if len(s.filters) > 0 {
+		h = s.filters[0].hash
+	}
+	var r, fp float64
+	var hint, len uint64
+	err := binary.Read(stream, binary.BigEndian, &r)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &fp)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &hint)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &len)
+	if err != nil {
+		return 0, err
+	}
+	numBytes := int64(4 * binary.Size(uint64(0)))
+	filters := make([]*CuckooFilter, len)
+	for i := range filters {
+		filter := &CuckooFilter{hash: h}
+		num, err := filter.ReadFrom(stream)
+		if err != nil {
+			return 0, err
+		}
+		numBytes += num
+		filters[i] = filter
+	}
+	num, err := s.rand.ReadFrom(stream)
+	if err != nil {
+		return 0, err
+	}
+
+	s.r = r
+	s.fp = fp
+	s.hint = uint(hint)
+	s.filters = filters
+	if s.rand.source != nil {
+		// Every filter shares the restored source rather than its own copy.
+		s.SetRandSource(s.rand.source)
+	}
+	return numBytes + num, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (s *ScalableCuckooFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := s.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (s *ScalableCuckooFilter) GobDecode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := s.ReadFrom(buf)
+
+	return err
+}
@@ -0,0 +1,246 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/gob"
+	"hash/fnv"
+	"strconv"
+	"testing"
+)
+
+// Ensures that the filter adds progressively larger sub-filters as elements
+// are added and there are no false negatives.
+func TestScalableCuckooGrowth(t *testing.T) {
+	f := NewScalableCuckooFilter(100, 0.01, 0.8)
+
+	if capacity := f.Capacity(); capacity != 100 {
+		t.Errorf("Expected 100, got %d", capacity)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if err := f.Add([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if filters := f.Filters(); filters != 4 {
+		t.Errorf("Expected 4, got %d", filters)
+	}
+
+	if capacity := f.Capacity(); capacity != 1500 {
+		t.Errorf("Expected 1500, got %d", capacity)
+	}
+
+	if count := f.Count(); count != 1000 {
+		t.Errorf("Expected 1000, got %d", count)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+}
+
+// Ensures that the compounded false-positive rate stays within the target.
+func TestScalableCuckooFalsePositiveRate(t *testing.T) {
+	f := NewScalableCuckooFilter(100, 0.01, 0.8)
+	for i := 0; i < 10000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	fps := 0
+	for i := 10000; i < 110000; i++ {
+		if f.Test([]byte(strconv.Itoa(i))) {
+			fps++
+		}
+	}
+
+	if rate := float64(fps) / 100000; rate > 0.01 {
+		t.Errorf("Expected false-positive rate at most 0.01, got %f", rate)
+	}
+}
+
+// Ensures that elements can be removed from any sub-filter.
+func TestScalableCuckooTestAndRemove(t *testing.T) {
+	f := NewScalableCuckooFilter(100, 0.0001, 0.8)
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	for i := 0; i < 1000; i += 2 {
+		if !f.TestAndRemove([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+
+	if count := f.Count(); count != 500 {
+		t.Errorf("Expected 500, got %d", count)
+	}
+
+	for i := 1; i < 1000; i += 2 {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+}
+
+// Ensures that TestAndAdd behaves correctly.
+func TestScalableCuckooTestAndAdd(t *testing.T) {
+	f := NewDefaultScalableCuckooFilter(0.01)
+
+	member, err := f.TestAndAdd([]byte(`a`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if member {
+		t.Error("`a` should not be a member")
+	}
+
+	member, err = f.TestAndAdd([]byte(`a`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !member {
+		t.Error("`a` should be a member")
+	}
+
+	if count := f.Count(); count != 1 {
+		t.Errorf("Expected 1, got %d", count)
+	}
+}
+
+// Ensures that Reset removes all sub-filters but the first and clears it.
+func TestScalableCuckooReset(t *testing.T) {
+	f := NewScalableCuckooFilter(100, 0.01, 0.8)
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if f.Reset() != f {
+		t.Error("Returned ScalableCuckooFilter should be the same instance")
+	}
+
+	if filters := f.Filters(); filters != 1 {
+		t.Errorf("Expected 1, got %d", filters)
+	}
+
+	if count := f.Count(); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+}
+
+// Ensures that the whole chain of sub-filters can be serialized and resumed.
+func TestScalableCuckooSerialization(t *testing.T) {
+	f := NewScalableCuckooFilter(100, 0.01, 0.8)
+	f.SetRandSource(NewRandSource(42))
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(f); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &ScalableCuckooFilter{}
+	if err := gob.NewDecoder(&buf).Decode(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	wn, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := NewDefaultScalableCuckooFilter(0.1)
+	rn, err := read.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wn != rn {
+		t.Errorf("Expected %d bytes read, got %d", wn, rn)
+	}
+
+	for i := 1000; i < 2000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+		decoded.Add([]byte(strconv.Itoa(i)))
+		read.Add([]byte(strconv.Itoa(i)))
+	}
+
+	for _, filter := range []*ScalableCuckooFilter{decoded, read} {
+		if filters := filter.Filters(); filters != f.Filters() {
+			t.Errorf("Expected %d, got %d", f.Filters(), filters)
+		}
+
+		if count := filter.Count(); count != 2000 {
+			t.Errorf("Expected 2000, got %d", count)
+		}
+
+		for i := 0; i < 2000; i++ {
+			if !filter.TestAndRemove([]byte(strconv.Itoa(i))) {
+				t.Errorf("Expected %d to be a member", i)
+			}
+		}
+	}
+}
+
+// Ensures that a filter with a custom hash can be resumed by a filter using the
+// same hash, which then applies to every sub-filter.
+func TestScalableCuckooSerializationCustomHash(t *testing.T) {
+	f := NewScalableCuckooFilter(100, 0.01, 0.8)
+	f.SetHash(fnv.New32a())
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	read := NewDefaultScalableCuckooFilter(0.1)
+	read.SetHash(fnv.New32a())
+	if _, err := read.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if filters := read.Filters(); filters < 2 {
+		t.Errorf("Expected several filters, got %d", filters)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if !read.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+}
+
+func BenchmarkScalableCuckooAdd(b *testing.B) {
+	b.StopTimer()
+	f := NewDefaultScalableCuckooFilter(0.01)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
+
+func BenchmarkScalableCuckooTest(b *testing.B) {
+	b.StopTimer()
+	f := NewDefaultScalableCuckooFilter(0.01)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Test(data[n])
+	}
+}
@@ -0,0 +1,359 @@
+package boom
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// ssCounter monitors an element and its frequency.
+type ssCounter struct {
+	data   string        // monitored element
+	err    uint64        // maximum overestimation of the count
+	bucket *list.Element // bucket holding the counter
+}
+
+// ssBucket holds the counters which share the same count.
+type ssBucket struct {
+	count    uint64     // count shared by the counters
+	counters *list.List // counters with this count
+}
+
+// SpaceSaving implements the Space-Saving algorithm using the Stream-Summary
+// data structure as described by Metwally, Agrawal, and El Abbadi in Efficient
+// Computation of Frequent and Top-k Elements in Data Streams:
+//
+// https://www.cs.ucsb.edu/sites/default/files/documents/2005-23.pdf
+//
+// Space-Saving monitors at most k elements with a counter each. When an
+// unmonitored element arrives and every counter is in use, the counter with
+// the minimum count is reassigned to the new element and incremented, and the
+// previous minimum is recorded as the maximum overestimation of the new
+// element. Counters are grouped into buckets of equal count kept in sorted
+// order, so incrementing a counter is O(1).
+//
+// Unlike TopK, which relies on a Count-Min Sketch whose counts may be
+// inflated by collisions, the error of every element reported by
+// Space-Saving is bounded and known. Any element whose true frequency exceeds
+// N/k is guaranteed to be monitored. Summaries from multiple workers can be
+// merged.
+type SpaceSaving struct {
+	counters map[string]*list.Element // counters by element
+	buckets  *list.List               // buckets sorted by ascending count
+	k        uint                     // number of counters
+	n        uint64                   // number of items added
+}
+
+// NewSpaceSaving creates a new Space-Saving summary which monitors at most k
+// elements.
+func NewSpaceSaving(k uint) *SpaceSaving {
+	if k == 0 {
+		k = 1
+	}
+	return &SpaceSaving{
+		counters: make(map[string]*list.Element, k),
+		buckets:  list.New(),
+		k:        k,
+	}
+}
+
+// K returns the number of counters.
+func (s *SpaceSaving) K() uint {
+	return s.k
+}
+
+// TotalCount returns the number of items added to the summary.
+func (s *SpaceSaving) TotalCount() uint64 {
+	return s.n
+}
+
+// Add will add the data to the summary. Returns the SpaceSaving to allow for
+// chaining.
+func (s *SpaceSaving) Add(data []byte) *SpaceSaving {
+	return s.AddN(data, 1)
+}
+
+// AddN will add the data to the summary n times. Returns the SpaceSaving to
+// allow for chaining.
+func (s *SpaceSaving) AddN(data []byte, n uint64) *SpaceSaving {
+	if n == 0 {
+		return s
+	}
+	s.n += n
+	s.add(string(data), n, 0)
+	return s
+}
+
+// Count returns the estimated frequency of the data and the maximum
+// overestimation of that frequency. If the data isn't monitored, both are
+// zero.
+func (s *SpaceSaving) Count(data []byte) (uint64, uint64) {
+	e, ok := s.counters[string(data)]
+	if !ok {
+		return 0, 0
+	}
+	counter := e.Value.(*ssCounter)
+	return counter.bucket.Value.(*ssBucket).count, counter.err
+}
+
+// Elements returns the monitored elements from lowest to highest frequency.
+// Each element's frequency is overestimated by at most its Error.
+func (s *SpaceSaving) Elements() []*Element {
+	elements := make([]*Element, 0, len(s.counters))
+	for b := s.buckets.Front(); b != nil; b = b.Next() {
+		bucket := b.Value.(*ssBucket)
+		for c := bucket.counters.Front(); c != nil; c = c.Next() {
+			counter := c.Value.(*ssCounter)
+			elements = append(elements, &Element{
+				Data:  []byte(counter.data),
+				Freq:  bucket.count,
+				Error: counter.err,
+			})
+		}
+	}
+	return elements
+}
+
+// Merge combines this summary with another as described by Agarwal, Cormode,
+// Huang, Phillips, Wei, and Yi in Mergeable Summaries. An element missing from
+// a full summary may have occurred up to that summary's minimum count, so the
+// minimum is added to both its count and error. Only the k most frequent
+// elements are kept. The other summary is not modified.
+func (s *SpaceSaving) Merge(other *SpaceSaving) {
+	var (
+		minS     = s.min()
+		minOther = other.min()
+		merged   = make(map[string]*Element, len(s.counters)+len(other.counters))
+	)
+	for _, element := range s.Elements() {
+		element.Freq += minOther
+		element.Error += minOther
+		merged[string(element.Data)] = element
+	}
+	for _, element := range other.Elements() {
+		if existing, ok := merged[string(element.Data)]; ok {
+			existing.Freq += element.Freq - minOther
+			existing.Error += element.Error - minOther
+			continue
+		}
+		element.Freq += minS
+		element.Error += minS
+		merged[string(element.Data)] = element
+	}
+
+	elements := make([]*Element, 0, len(merged))
+	for _, element := range merged {
+		elements = append(elements, element)
+	}
+	sort.Slice(elements, func(i, j int) bool {
+		if elements[i].Freq != elements[j].Freq {
+			return elements[i].Freq > elements[j].Freq
+		}
+		return bytes.Compare(elements[i].Data, elements[j].Data) < 0
+	})
+	if uint(len(elements)) > s.k {
+		elements = elements[:s.k]
+	}
+
+	n := s.n + other.n
+	s.Reset()
+	s.n = n
+	for _, element := range elements {
+		s.add(string(element.Data), element.Freq, element.Error)
+	}
+}
+
+// Reset restores the SpaceSaving to its original state. It returns itself to
+// allow for chaining.
+func (s *SpaceSaving) Reset() *SpaceSaving {
+	s.counters = make(map[string]*list.Element, s.k)
+	s.buckets.Init()
+	s.n = 0
+	return s
+}
+
+// add increments the counter for the data by n, assigning it a counter if it
+// isn't monitored. A new counter has the given error unless it replaces the
+// minimum counter, in which case the minimum count is used.
+func (s *SpaceSaving) add(data string, n, err uint64) {
+	if e, ok := s.counters[data]; ok {
+		s.increment(e, n)
+		return
+	}
+
+	if uint(len(s.counters)) < s.k {
+		b := s.bucketFor(nil, n)
+		counter := &ssCounter{data: data, err: err, bucket: b}
+		s.counters[data] = b.Value.(*ssBucket).counters.PushBack(counter)
+		return
+	}
+
+	// Replace the element with the minimum count.
+	var (
+		front   = s.buckets.Front().Value.(*ssBucket)
+		e       = front.counters.Front()
+		counter = e.Value.(*ssCounter)
+	)
+	delete(s.counters, counter.data)
+	counter.data = data
+	counter.err = front.count
+	s.counters[data] = e
+	s.increment(e, n)
+}
+
+// increment moves the counter to the bucket for its count plus n.
+func (s *SpaceSaving) increment(e *list.Element, n uint64) {
+	var (
+		counter = e.Value.(*ssCounter)
+		from    = counter.bucket
+		bucket  = from.Value.(*ssBucket)
+		to      = s.bucketFor(from, bucket.count+n)
+	)
+
+	bucket.counters.Remove(e)
+	counter.bucket = to
+	s.counters[counter.data] = to.Value.(*ssBucket).counters.PushBack(counter)
+
+	if bucket.counters.Len() == 0 {
+		s.buckets.Remove(from)
+	}
+}
+
+// bucketFor returns the bucket with the given count, searching forward from
+// the given bucket or the front if nil. The bucket is created if it doesn't
+// exist. Since counts only grow, this is O(1) for unit increments.
+func (s *SpaceSaving) bucketFor(from *list.Element, count uint64) *list.Element {
+	if from == nil {
+		from = s.buckets.Front()
+		if from == nil || from.Value.(*ssBucket).count > count {
+			return s.buckets.PushFront(newSSBucket(count))
+		}
+	}
+
+	for from.Next() != nil && from.Next().Value.(*ssBucket).count <= count {
+		from = from.Next()
+	}
+	if from.Value.(*ssBucket).count == count {
+		return from
+	}
+	return s.buckets.InsertAfter(newSSBucket(count), from)
+}
+
+// min returns the minimum count if every counter is in use, zero otherwise.
+func (s *SpaceSaving) min() uint64 {
+	if uint(len(s.counters)) < s.k {
+		return 0
+	}
+	return s.buckets.Front().Value.(*ssBucket).count
+}
+
+// newSSBucket returns an empty bucket with the given count.
+func newSSBucket(count uint64) *ssBucket {
+	return &ssBucket{count: count, counters: list.New()}
+}
+
+// WriteTo writes a binary representation of the SpaceSaving to an i/o stream.
+// It returns the number of bytes written.
+func (s *SpaceSaving) WriteTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, uint64(s.k))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, s.n)
+	if err != nil {
+		return 0, err
+	}
+	elements := s.Elements()
+	err = binary.Write(stream, binary.BigEndian, uint64(len(elements)))
+	if err != nil {
+		return 0, err
+	}
+	numBytes := int64(3 * binary.Size(uint64(0)))
+	for _, element := range elements {
+		err = binary.Write(stream, binary.BigEndian, element.Freq)
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Write(stream, binary.BigEndian, element.Error)
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Write(stream, binary.BigEndian, uint64(len(element.Data)))
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Write(stream, binary.BigEndian, element.Data)
+		if err != nil {
+			return 0, err
+		}
+		numBytes += int64(3*binary.Size(uint64(0)) + len(element.Data))
+	}
+	return numBytes, nil
+}
+
+// ReadFrom reads a binary representation of SpaceSaving (such as might have
+// been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (s *SpaceSaving) ReadFrom(stream io.Reader) (int64, error) {
+	var k, n, len uint64
+	err := binary.Read(stream, binary.BigEndian, &k)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &n)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &len)
+	if err != nil {
+		return 0, err
+	}
+
+	*s = *NewSpaceSaving(uint(k))
+	s.n = n
+	numBytes := int64(3 * binary.Size(uint64(0)))
+	for i := uint64(0); i < len; i++ {
+		var freq, e, size uint64
+		err = binary.Read(stream, binary.BigEndian, &freq)
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Read(stream, binary.BigEndian, &e)
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Read(stream, binary.BigEndian, &size)
+		if err != nil {
+			return 0, err
+		}
+		data := make([]byte, size)
+		err = binary.Read(stream, binary.BigEndian, data)
+		if err != nil {
+			return 0, err
+		}
+		s.add(string(data), freq, e)
+		numBytes += int64(3*binary.Size(uint64(0))) + int64(size)
+	}
+	return numBytes, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (s *SpaceSaving) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := s.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (s *SpaceSaving) GobDecode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := s.ReadFrom(buf)
+
+	return err
+}
@@ -0,0 +1,188 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strconv"
+	"testing"
+)
+
+// Ensures that SpaceSaving returns the most frequent elements with their
+// counts.
+func TestSpaceSaving(t *testing.T) {
+	s := NewSpaceSaving(5)
+
+	s.Add([]byte(`bob`)).Add([]byte(`bob`)).Add([]byte(`bob`))
+	s.Add([]byte(`tyler`)).Add([]byte(`tyler`)).Add([]byte(`tyler`)).Add([]byte(`tyler`)).Add([]byte(`tyler`))
+	s.Add([]byte(`fred`))
+	s.Add([]byte(`alice`)).Add([]byte(`alice`)).Add([]byte(`alice`)).Add([]byte(`alice`))
+	s.Add([]byte(`sara`)).Add([]byte(`sara`))
+	s.Add([]byte(`fred`))
+
+	if s.Add([]byte(`bill`)) != s {
+		t.Error("Returned SpaceSaving should be the same instance")
+	}
+
+	expected := []struct {
+		name string
+		freq uint64
+		err  uint64
+	}{
+		{"fred", 2, 0},
+		{"bob", 3, 0},
+		{"bill", 3, 2},
+		{"alice", 4, 0},
+		{"tyler", 5, 0},
+	}
+
+	actual := s.Elements()
+	if l := len(actual); l != 5 {
+		t.Fatalf("Expected len %d, got %d", 5, l)
+	}
+
+	for i, element := range actual {
+		if e := string(element.Data); e != expected[i].name {
+			t.Errorf("Expected %s, got %s", expected[i].name, e)
+		}
+		if freq := element.Freq; freq != expected[i].freq {
+			t.Errorf("Expected %d, got %d", expected[i].freq, freq)
+		}
+		if err := element.Error; err != expected[i].err {
+			t.Errorf("Expected error %d, got %d", expected[i].err, err)
+		}
+	}
+
+	if freq, err := s.Count([]byte(`bill`)); freq != 3 || err != 2 {
+		t.Errorf("Expected 3 and 2, got %d and %d", freq, err)
+	}
+
+	// `sara` was replaced by `bill`.
+	if freq, err := s.Count([]byte(`sara`)); freq != 0 || err != 0 {
+		t.Errorf("Expected 0 and 0, got %d and %d", freq, err)
+	}
+
+	if total := s.TotalCount(); total != 17 {
+		t.Errorf("Expected 17, got %d", total)
+	}
+
+	if s.Reset() != s {
+		t.Error("Returned SpaceSaving should be the same instance")
+	}
+
+	if l := len(s.Elements()); l != 0 {
+		t.Errorf("Expected 0, got %d", l)
+	}
+}
+
+// Ensures that the true frequency of every element is within its error bound
+// for a skewed stream.
+func TestSpaceSavingErrorBounds(t *testing.T) {
+	var (
+		s      = NewSpaceSaving(50)
+		actual = make(map[string]uint64)
+	)
+	for i := 1; i <= 200; i++ {
+		key := strconv.Itoa(i)
+		n := uint64(10000 / i)
+		actual[key] += n
+		for j := uint64(0); j < n; j++ {
+			s.Add([]byte(key))
+		}
+	}
+
+	elements := s.Elements()
+	for _, element := range elements {
+		freq := actual[string(element.Data)]
+		if element.Freq < freq || element.Freq-element.Error > freq {
+			t.Errorf("Expected %d within [%d, %d]", freq, element.Freq-element.Error, element.Freq)
+		}
+	}
+
+	if top := string(elements[len(elements)-1].Data); top != "1" {
+		t.Errorf("Expected 1, got %s", top)
+	}
+}
+
+// Ensures that Merge combines summaries from multiple workers.
+func TestSpaceSavingMerge(t *testing.T) {
+	var (
+		merged = NewSpaceSaving(10)
+		actual = make(map[string]uint64)
+	)
+	for worker := 0; worker < 4; worker++ {
+		s := NewSpaceSaving(10)
+		for i := 1; i <= 50; i++ {
+			key := strconv.Itoa((i + worker*7) % 50)
+			n := uint64(1000 / i)
+			actual[key] += n
+			s.AddN([]byte(key), n)
+		}
+		merged.Merge(s)
+	}
+
+	elements := merged.Elements()
+	if l := len(elements); l != 10 {
+		t.Fatalf("Expected len %d, got %d", 10, l)
+	}
+
+	for _, element := range elements {
+		freq := actual[string(element.Data)]
+		if element.Freq < freq || element.Freq-element.Error > freq {
+			t.Errorf("Expected %d within [%d, %d]", freq, element.Freq-element.Error, element.Freq)
+		}
+	}
+
+	total := uint64(0)
+	for _, freq := range actual {
+		total += freq
+	}
+	if count := merged.TotalCount(); count != total {
+		t.Errorf("Expected %d, got %d", total, count)
+	}
+}
+
+// Ensures that SpaceSaving can be serialized and deserialized without errors.
+func TestSpaceSavingSerialization(t *testing.T) {
+	s := NewSpaceSaving(10)
+	for i := 0; i < 100; i++ {
+		s.AddN([]byte(strconv.Itoa(i)), uint64(i%13))
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(s); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &SpaceSaving{}
+	if err := gob.NewDecoder(&buf).Decode(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, actual := s.Elements(), decoded.Elements()
+	if len(expected) != len(actual) {
+		t.Fatalf("Expected len %d, got %d", len(expected), len(actual))
+	}
+	for i := range expected {
+		if expected[i].Freq != actual[i].Freq || expected[i].Error != actual[i].Error {
+			t.Errorf("Expected %v, got %v", expected[i], actual[i])
+		}
+	}
+
+	if decoded.TotalCount() != s.TotalCount() || decoded.K() != s.K() {
+		t.Error("Expected total count and k to match")
+	}
+}
+
+func BenchmarkSpaceSavingAdd(b *testing.B) {
+	b.StopTimer()
+	s := NewSpaceSaving(100)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i % 1000))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		s.Add(data[n])
+	}
+}
@@ -3,11 +3,13 @@ package boom
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"hash"
 	"hash/fnv"
 	"io"
 	"math"
 	"math/rand"
+	"time"
 )
 
 // StableBloomFilter implements a Stable Bloom Filter as described by Deng and
@@ -33,16 +35,44 @@ import (
 // and memory is bounded.  For example, an SBF can be used to deduplicate
 // events from an unbounded event stream with a specified upper bound on false
 // positives and minimal false negatives.
+//
+// By default, cells are decremented on every add, so how long an element is
+// retained depends on the rate of insertions. A timed SBF instead decrements
+// cells as wall-clock time passes, sweeping through every cell once every
+// retention period divided by the cell max value. This retains elements for a
+// predictable period regardless of the rate of insertions.
 type StableBloomFilter struct {
-	cells       *Buckets    // filter data
-	hash        hash.Hash64 // hash function (kernel for all k functions)
-	m           uint        // number of cells
-	p           uint        // number of cells to decrement
-	k           uint        // number of hash functions
-	max         uint8       // cell max value
-	indexBuffer []uint      // buffer used to cache indices
+	cells       *Buckets         // filter data
+	hash        hash.Hash64      // hash function (kernel for all k functions)
+	m           uint             // number of cells
+	p           uint             // number of cells to decrement
+	k           uint             // number of hash functions
+	max         uint8            // cell max value
+	indexBuffer []uint           // buffer used to cache indices
+	retention   time.Duration    // time for a cell to decay to zero, if timed
+	cursor      uint             // next cell to decrement, if timed
+	swept       time.Time        // time of the last decrement, if timed
+	clock       func() time.Time // current time, if timed
+	rand        randGen          // source of cells to decrement
 }
 
+const (
+	// stableFormatFlag is set in the first word written by WriteTo to mark it
+	// as a format version. Filters written before formats were versioned start
+	// with the number of cells instead, which never has this bit set.
+	stableFormatFlag = uint64(1) << 63
+
+	// stableFormatVersion is the version of the format written by WriteTo.
+	stableFormatVersion = 1
+)
+
+// Modes of a serialized filter, which determine the fields that follow the
+// cells.
+const (
+	stableModeUntimed uint8 = iota
+	stableModeTimed
+)
+
 // NewStableBloomFilter creates a new Stable Bloom Filter with m cells and d
 // bits allocated per cell optimized for the target false-positive rate. Use
 // NewDefaultStableFilter if you don't want to calculate d.
@@ -96,6 +126,36 @@ func NewUnstableBloomFilter(m uint, fpRate float64) *StableBloomFilter {
 	}
 }
 
+// NewTimedStableBloomFilter creates a new Stable Bloom Filter with m cells and
+// d bits allocated per cell whose cells decay to zero over the retention
+// period as wall-clock time passes, rather than on every add. An element is
+// retained for between (max-1)/max and all of the retention period, where max
+// is 2^d-1, so more bits per cell make retention more precise. Since the
+// number of elements retained depends on the rate of insertions, the filter
+// should be sized for the expected number of elements per retention period.
+func NewTimedStableBloomFilter(m uint, d uint8, fpRate float64,
+	retention time.Duration) *StableBloomFilter {
+	k := OptimalK(fpRate)
+	if k > m {
+		k = m
+	}
+
+	cells := NewBuckets(m, d)
+
+	return &StableBloomFilter{
+		hash:        fnv.New64(),
+		m:           m,
+		k:           k,
+		p:           0,
+		max:         cells.MaxBucketValue(),
+		cells:       cells,
+		indexBuffer: make([]uint, k),
+		retention:   retention,
+		swept:       time.Now(),
+		clock:       time.Now,
+	}
+}
+
 // Cells returns the number of cells in the Stable Bloom Filter.
 func (s *StableBloomFilter) Cells() uint {
 	return s.m
@@ -111,9 +171,17 @@ func (s *StableBloomFilter) P() uint {
 	return s.p
 }
 
+// Retention returns the time for a cell to decay to zero, or zero if cells
+// are decremented on every add.
+func (s *StableBloomFilter) Retention() time.Duration {
+	return s.retention
+}
+
 // StablePoint returns the limit of the expected fraction of zeros in the
 // Stable Bloom Filter when the number of iterations goes to infinity. When
-// this limit is reached, the Stable Bloom Filter is considered stable.
+// this limit is reached, the Stable Bloom Filter is considered stable. It's
+// undefined for timed filters, whose stable point depends on the rate of
+// insertions, and returns 0 for them since no cells are decremented on add.
 func (s *StableBloomFilter) StablePoint() float64 {
 	var (
 		subDenom = float64(s.p) * (1/float64(s.k) - 1/float64(s.m))
@@ -125,15 +193,18 @@ func (s *StableBloomFilter) StablePoint() float64 {
 }
 
 // FalsePositiveRate returns the upper bound on false positives when the filter
-// has become stable.
+// has become stable. Like StablePoint, it's undefined for timed filters and
+// returns 1 for them.
 func (s *StableBloomFilter) FalsePositiveRate() float64 {
 	return math.Pow(1-s.StablePoint(), float64(s.k))
 }
 
 // Test will test for membership of the data and returns true if it is a
 // member, false if not. This is a probabilistic test, meaning there is a
-// non-zero probability of false positives and false negatives.
+// non-zero probability of false positives and false negatives. For timed
+// filters, cells are decayed for the elapsed time first.
 func (s *StableBloomFilter) Test(data []byte) bool {
+	s.sweep()
 	lower, upper := hashKernel(data, s.hash)
 
 	// If any of the K cells are 0, then it's not a member.
@@ -149,7 +220,9 @@ func (s *StableBloomFilter) Test(data []byte) bool {
 // Add will add the data to the Stable Bloom Filter. It returns the filter to
 // allow for chaining.
 func (s *StableBloomFilter) Add(data []byte) Filter {
-	// Randomly decrement p cells to make room for new elements.
+	// Decay cells for the elapsed time if timed, otherwise randomly decrement
+	// p cells to make room for new elements.
+	s.sweep()
 	s.decrement()
 
 	lower, upper := hashKernel(data, s.hash)
@@ -165,6 +238,7 @@ func (s *StableBloomFilter) Add(data []byte) Filter {
 // TestAndAdd is equivalent to calling Test followed by Add. It returns true if
 // the data is a member, false if not.
 func (s *StableBloomFilter) TestAndAdd(data []byte) bool {
+	s.sweep()
 	lower, upper := hashKernel(data, s.hash)
 	member := true
 
@@ -191,15 +265,64 @@ func (s *StableBloomFilter) TestAndAdd(data []byte) bool {
 // filter to allow for chaining.
 func (s *StableBloomFilter) Reset() *StableBloomFilter {
 	s.cells.Reset()
+	if s.retention > 0 {
+		s.cursor = 0
+		s.swept = s.clock()
+	}
 	return s
 }
 
+// SetClock sets the function used to get the current time for timed filters,
+// which defaults to time.Now. Decay is measured from the clock's current time,
+// so it should be set before any data is added.
+func (s *StableBloomFilter) SetClock(clock func() time.Time) {
+	s.clock = clock
+	s.swept = clock()
+}
+
+// sweep decrements cells in order for a timed filter, at a rate which decays
+// every cell from max to zero over the retention period. If the filter has
+// been idle for the entire retention period, all cells are reset.
+func (s *StableBloomFilter) sweep() {
+	if s.retention <= 0 {
+		return
+	}
+
+	var (
+		now   = s.clock()
+		rate  = float64(s.m) * float64(s.max) / float64(s.retention)
+		cells = uint64(float64(now.Sub(s.swept)) * rate)
+	)
+	if cells == 0 {
+		return
+	}
+
+	if cells >= uint64(s.m)*uint64(s.max) {
+		s.cells.Reset()
+		s.swept = now
+		return
+	}
+
+	for i := uint64(0); i < cells; i++ {
+		s.cells.Increment(s.cursor, -1)
+		s.cursor = (s.cursor + 1) % s.m
+	}
+
+	// Carry over the time for any partial cell.
+	s.swept = s.swept.Add(time.Duration(float64(cells) / rate))
+}
+
 // decrement will decrement a random cell and (p-1) adjacent cells by 1. This
 // is faster than generating p random numbers. Although the processes of
 // picking the p cells are not independent, each cell has a probability of p/m
 // for being picked at each iteration, which means the properties still hold.
+// Timed filters are decayed by sweep instead, so nothing is decremented.
 func (s *StableBloomFilter) decrement() {
-	r := rand.Intn(int(s.m))
+	if s.retention > 0 {
+		return
+	}
+
+	r := s.rand.Intn(int(s.m))
 	for i := uint(0); i < s.p; i++ {
 		idx := (r + int(i)) % int(s.m)
 		s.cells.Increment(uint(idx), -1)
@@ -212,10 +335,22 @@ func (s *StableBloomFilter) SetHash(h hash.Hash64) {
 	s.hash = h
 }
 
+// SetRandSource sets the source used to pick the cells to decrement, which
+// defaults to the global math/rand source. Filters using the same seeded
+// source end up in identical states for identical input. The state of a
+// source created with NewRandSource is persisted by WriteTo.
+func (s *StableBloomFilter) SetRandSource(src rand.Source) {
+	s.rand.setSource(src)
+}
+
 // WriteTo writes a binary representation of the StableBloomFilter to an i/o stream.
 // It returns the number of bytes written.
 func (s *StableBloomFilter) WriteTo(stream io.Writer) (int64, error) {
-	err := binary.Write(stream, binary.BigEndian, uint64(s.m))
+	err := binary.Write(stream, binary.BigEndian, stableFormatFlag|stableFormatVersion)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(s.m))
 	if err != nil {
 		return 0, err
 	}
@@ -245,20 +380,68 @@ func (s *StableBloomFilter) WriteTo(stream io.Writer) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	return int64((3+len(s.indexBuffer))*binary.Size(uint64(0))) +
-		int64(1*binary.Size(uint8(0))) + int64(1*binary.Size(int64(0))) + n, err
+	numBytes := int64((5+len(s.indexBuffer))*binary.Size(uint64(0))) +
+		int64(2*binary.Size(uint8(0))) + n
+
+	mode := stableModeUntimed
+	if s.retention > 0 {
+		mode = stableModeTimed
+	}
+	err = binary.Write(stream, binary.BigEndian, mode)
+	if err != nil {
+		return 0, err
+	}
+	if mode == stableModeTimed {
+		err = binary.Write(stream, binary.BigEndian, int64(s.retention))
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Write(stream, binary.BigEndian, uint64(s.cursor))
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Write(stream, binary.BigEndian, s.swept.UnixNano())
+		if err != nil {
+			return 0, err
+		}
+		numBytes += int64(binary.Size(uint64(0)) + 2*binary.Size(int64(0)))
+	}
+
+	r, err := s.rand.WriteTo(stream)
+	if err != nil {
+		return 0, err
+	}
+	return numBytes + r, err
 }
 
 // ReadFrom reads a binary representation of StableBloomFilter (such as might
-// have been written by WriteTo()) from an i/o stream. It returns the number
+// have been written by WriteTo()) from an i/o stream. Filters written before
+// the format was versioned are read as untimed filters. It returns the number
 // of bytes read.
 func (s *StableBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
-	var m, p, k, bufferLen uint64
+	var header, m, p, k, bufferLen uint64
 	var max uint8
-	err := binary.Read(stream, binary.BigEndian, &m)
+	err := binary.Read(stream, binary.BigEndian, &header)
 	if err != nil {
 		return 0, err
 	}
+	numBytes := int64(binary.Size(uint64(0)))
+
+	// Filters written before formats were versioned start with the number of
+	// cells and end after them.
+	versioned := header&stableFormatFlag != 0
+	if versioned {
+		if version := header &^ stableFormatFlag; version != stableFormatVersion {
+			return 0, fmt.Errorf("unsupported format version %d", version)
+		}
+		err = binary.Read(stream, binary.BigEndian, &m)
+		if err != nil {
+			return 0, err
+		}
+		numBytes += int64(binary.Size(uint64(0)))
+	} else {
+		m = header
+	}
 	err = binary.Read(stream, binary.BigEndian, &p)
 	if err != nil {
 		return 0, err
@@ -294,8 +477,54 @@ func (s *StableBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	return int64((3+len(s.indexBuffer))*binary.Size(uint64(0))) +
-		int64(1*binary.Size(uint8(0))) + int64(1*binary.Size(int64(0))) + n, nil
+	numBytes += int64((3+len(s.indexBuffer))*binary.Size(uint64(0))) +
+		int64(1*binary.Size(uint8(0))) + n
+
+	s.retention = 0
+	s.cursor = 0
+	if !versioned {
+		return numBytes, nil
+	}
+
+	var mode uint8
+	err = binary.Read(stream, binary.BigEndian, &mode)
+	if err != nil {
+		return 0, err
+	}
+	numBytes += int64(binary.Size(uint8(0)))
+	switch mode {
+	case stableModeUntimed:
+	case stableModeTimed:
+		var retention, swept int64
+		var cursor uint64
+		err = binary.Read(stream, binary.BigEndian, &retention)
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Read(stream, binary.BigEndian, &cursor)
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Read(stream, binary.BigEndian, &swept)
+		if err != nil {
+			return 0, err
+		}
+		s.retention = time.Duration(retention)
+		s.cursor = uint(cursor)
+		s.swept = time.Unix(0, swept)
+		if s.clock == nil {
+			s.clock = time.Now
+		}
+		numBytes += int64(binary.Size(uint64(0)) + 2*binary.Size(int64(0)))
+	default:
+		return 0, fmt.Errorf("unsupported filter mode %d", mode)
+	}
+
+	r, err := s.rand.ReadFrom(stream)
+	if err != nil {
+		return 0, err
+	}
+	return numBytes + r, nil
 }
 
 // GobEncode implements gob.GobEncoder interface.
@@ -2,10 +2,13 @@ package boom
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/gob"
 	"math"
+	"math/rand"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/d4l3k/messagediff"
 )
@@ -110,6 +113,7 @@ func TestTestAndAdd(t *testing.T) {
 // iterations.
 func TestStablePoint(t *testing.T) {
 	f := NewStableBloomFilter(1000, 1, 0.1)
+	f.SetRandSource(NewRandSource(4))
 	for i := 0; i < 1000000; i++ {
 		f.Add([]byte(strconv.Itoa(i)))
 	}
@@ -136,6 +140,51 @@ func TestStablePoint(t *testing.T) {
 	}
 }
 
+// Ensures that filters using the same seeded source end up in identical
+// states and a serialized filter continues the same sequence.
+func TestStableRandSource(t *testing.T) {
+	f1 := NewDefaultStableBloomFilter(1000, 0.01)
+	f1.SetRandSource(NewRandSource(42))
+	f2 := NewDefaultStableBloomFilter(1000, 0.01)
+	f2.SetRandSource(NewRandSource(42))
+	for i := 0; i < 5000; i++ {
+		f1.Add([]byte(strconv.Itoa(i)))
+		f2.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var buf1, buf2 bytes.Buffer
+	if _, err := f1.WriteTo(&buf1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f2.WriteTo(&buf2); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf1.Bytes(), buf2.Bytes()) {
+		t.Error("Expected filters with the same seed to be identical")
+	}
+
+	read := NewDefaultStableBloomFilter(1000, 0.01)
+	if _, err := read.ReadFrom(&buf1); err != nil {
+		t.Fatal(err)
+	}
+	for i := 5000; i < 10000; i++ {
+		f2.Add([]byte(strconv.Itoa(i)))
+		read.Add([]byte(strconv.Itoa(i)))
+	}
+
+	buf1.Reset()
+	buf2.Reset()
+	if _, err := read.WriteTo(&buf1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f2.WriteTo(&buf2); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf1.Bytes(), buf2.Bytes()) {
+		t.Error("Expected restored filter to continue the same sequence")
+	}
+}
+
 // Ensures that FalsePositiveRate returns the upper bound on false positives
 // for stable filters.
 func TestFalsePositiveRate(t *testing.T) {
@@ -193,6 +242,248 @@ func TestStableGob(t *testing.T) {
 	}
 }
 
+// Ensures that a timed filter retains elements for the retention period
+// regardless of the rate of insertions and evicts them afterward.
+func TestTimedStableBloom(t *testing.T) {
+	clock := newTestClock()
+	f := NewTimedStableBloomFilter(100000, 4, 0.01, 15*time.Minute)
+	f.SetClock(clock.Now)
+
+	if retention := f.Retention(); retention != 15*time.Minute {
+		t.Errorf("Expected 15m0s, got %s", retention)
+	}
+
+	f.Add([]byte(`a`))
+
+	// A burst of insertions doesn't evict `a`.
+	for i := 0; i < 5000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	clock.Advance(10 * time.Minute)
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+
+	clock.Advance(3*time.Minute + 59*time.Second)
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	clock.Advance(time.Minute + 2*time.Second)
+	if f.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+
+	if !f.Test([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+
+	// Idling for the retention period evicts everything.
+	clock.Advance(time.Hour)
+	if f.Test([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+	for i := uint(0); i < f.m; i++ {
+		if cell := f.cells.Get(i); cell != 0 {
+			t.Fatalf("Expected zero cell, got %d", cell)
+		}
+	}
+}
+
+// countingSource is a rand.Source which counts the numbers drawn from it.
+type countingSource struct {
+	rand.Source
+	draws int
+}
+
+func (c *countingSource) Int63() int64 {
+	c.draws++
+	return c.Source.Int63()
+}
+
+// Ensures that a timed filter doesn't randomly decrement cells on add and that
+// its stable point and false-positive rate are reported as undefined.
+func TestTimedStableBloomNoDecrement(t *testing.T) {
+	var (
+		f   = NewTimedStableBloomFilter(1000, 4, 0.01, time.Minute)
+		src = &countingSource{Source: NewRandSource(42)}
+	)
+	f.SetRandSource(src)
+
+	for i := 0; i < 100; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+		f.TestAndAdd([]byte(strconv.Itoa(i)))
+	}
+
+	if src.draws != 0 {
+		t.Errorf("Expected 0 draws, got %d", src.draws)
+	}
+
+	if stablePoint := f.StablePoint(); stablePoint != 0 {
+		t.Errorf("Expected 0, got %f", stablePoint)
+	}
+
+	if fps := f.FalsePositiveRate(); fps != 1 {
+		t.Errorf("Expected 1, got %f", fps)
+	}
+}
+
+// Ensures that a timed filter can be serialized and continues decaying from
+// where it left off.
+func TestTimedStableBloomSerialization(t *testing.T) {
+	clock := newTestClock()
+	f := NewTimedStableBloomFilter(1000, 4, 0.01, 15*time.Minute)
+	f.SetClock(clock.Now)
+	f.Add([]byte(`a`))
+	clock.Advance(10 * time.Minute)
+
+	var buf bytes.Buffer
+	wn, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f2 := NewDefaultStableBloomFilter(1000, 0.01)
+	f2.clock = clock.Now
+	rn, err := f2.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wn != rn {
+		t.Errorf("Expected %d bytes read, got %d", wn, rn)
+	}
+
+	if retention := f2.Retention(); retention != 15*time.Minute {
+		t.Errorf("Expected 15m0s, got %s", retention)
+	}
+
+	if !f2.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	clock.Advance(5*time.Minute + time.Second)
+	if f2.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+}
+
+// Ensures that an untimed filter read into a timed one replaces its mode.
+func TestStableSerializationMode(t *testing.T) {
+	f := NewDefaultStableBloomFilter(1000, 0.01)
+	f.Add([]byte(`a`))
+
+	var buf bytes.Buffer
+	wn, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f2 := NewTimedStableBloomFilter(1000, 4, 0.01, time.Minute)
+	rn, err := f2.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wn != rn {
+		t.Errorf("Expected %d bytes read, got %d", wn, rn)
+	}
+
+	if retention := f2.Retention(); retention != 0 {
+		t.Errorf("Expected 0s, got %s", retention)
+	}
+
+	if !f2.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+}
+
+// Ensures that filters written back to back, with and without a persisted
+// source, are read from the same stream without consuming each other's data.
+func TestStableSerializationStream(t *testing.T) {
+	seeded := NewDefaultStableBloomFilter(1000, 0.01)
+	seeded.SetRandSource(NewRandSource(42))
+	timed := NewTimedStableBloomFilter(1000, 4, 0.01, time.Minute)
+	filters := []*StableBloomFilter{seeded, timed, NewDefaultStableBloomFilter(100, 0.1)}
+	for i, f := range filters {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var buf bytes.Buffer
+	for _, f := range filters {
+		if _, err := f.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf.WriteString("trailing")
+
+	for i, f := range filters {
+		read := NewDefaultStableBloomFilter(10, 0.1)
+		if _, err := read.ReadFrom(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		if read.Retention() != f.Retention() || read.Cells() != f.Cells() {
+			t.Errorf("Expected filter %d to be restored", i)
+		}
+
+		if !read.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+
+	if rest := buf.String(); rest != "trailing" {
+		t.Errorf("Expected trailing data to be left, got %q", rest)
+	}
+}
+
+// Ensures that filters written before the format was versioned are read up to
+// their last cell.
+func TestStableSerializationUnversioned(t *testing.T) {
+	f := NewDefaultStableBloomFilter(1000, 0.01)
+	f.Add([]byte(`a`))
+
+	var buf bytes.Buffer
+	for _, value := range []uint64{uint64(f.m), uint64(f.p), uint64(f.k)} {
+		binary.Write(&buf, binary.BigEndian, value)
+	}
+	binary.Write(&buf, binary.BigEndian, f.max)
+	binary.Write(&buf, binary.BigEndian, int64(len(f.indexBuffer)))
+	for _, index := range f.indexBuffer {
+		binary.Write(&buf, binary.BigEndian, uint64(index))
+	}
+	f.cells.WriteTo(&buf)
+	size := int64(buf.Len())
+	buf.WriteString("trailing")
+
+	read := NewTimedStableBloomFilter(100, 4, 0.1, time.Minute)
+	n, err := read.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != size {
+		t.Errorf("Expected %d bytes read, got %d", size, n)
+	}
+
+	if retention := read.Retention(); retention != 0 {
+		t.Errorf("Expected 0s, got %s", retention)
+	}
+
+	if !read.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if rest := buf.String(); rest != "trailing" {
+		t.Errorf("Expected trailing data to be left, got %q", rest)
+	}
+}
+
 func BenchmarkStableAdd(b *testing.B) {
 	b.StopTimer()
 	f := NewDefaultStableBloomFilter(100000, 0.01)
@@ -0,0 +1,362 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+)
+
+// centroid is a cluster of values represented by their mean and total weight.
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// TDigest implements the merging variant of the t-digest as described by
+// Dunning and Ertl in Computing Extremely Accurate Quantiles Using t-Digests:
+//
+// https://arxiv.org/abs/1902.04023
+//
+// A t-digest approximates the distribution of a stream of values by clustering
+// them into a bounded number of weighted centroids. A scale function limits
+// the size of each centroid relative to its position in the distribution, so
+// centroids near the tails are small, which makes extreme quantiles such as
+// the 99.9th percentile very accurate while using little memory. Values are
+// buffered and periodically merged into the sorted centroids.
+//
+// t-digests are useful for tracking latency percentiles or other quantiles of
+// unbounded streams. Digests built on separate hosts can be merged. Accuracy
+// is best near the tails, but the rank error has no guaranteed bound. For
+// guaranteed rank error, refer to the KLL sketch.
+type TDigest struct {
+	centroids   []centroid // merged centroids sorted by mean
+	buffer      []centroid // values not yet merged
+	compression float64    // compression factor, delta
+	count       float64    // total weight of all values
+	min         float64    // minimum value added
+	max         float64    // maximum value added
+}
+
+// NewTDigest creates a new t-digest with the given compression factor, delta.
+// Higher compression yields more centroids and higher accuracy. The number of
+// centroids is bounded by roughly delta.
+func NewTDigest(compression float64) *TDigest {
+	if compression < 10 {
+		compression = 10
+	}
+	return &TDigest{
+		centroids:   make([]centroid, 0, int(compression)),
+		buffer:      make([]centroid, 0, tDigestBufferSize(compression)),
+		compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+// NewDefaultTDigest creates a new t-digest with a compression factor of 100,
+// which is accurate to within a fraction of a percent for most quantiles.
+func NewDefaultTDigest() *TDigest {
+	return NewTDigest(100)
+}
+
+// Compression returns the compression factor, delta.
+func (t *TDigest) Compression() float64 {
+	return t.compression
+}
+
+// Count returns the total weight of the values added to the digest.
+func (t *TDigest) Count() float64 {
+	return t.count
+}
+
+// Min returns the minimum value added to the digest.
+func (t *TDigest) Min() float64 {
+	return t.min
+}
+
+// Max returns the maximum value added to the digest.
+func (t *TDigest) Max() float64 {
+	return t.max
+}
+
+// Add will add the value to the digest with the given weight. Values which
+// are NaN or have a non-positive weight are ignored. Returns the TDigest to
+// allow for chaining.
+func (t *TDigest) Add(value, weight float64) *TDigest {
+	if math.IsNaN(value) || !(weight > 0) {
+		return t
+	}
+
+	t.buffer = append(t.buffer, centroid{mean: value, weight: weight})
+	t.count += weight
+	if value < t.min {
+		t.min = value
+	}
+	if value > t.max {
+		t.max = value
+	}
+
+	if len(t.buffer) >= tDigestBufferSize(t.compression) {
+		t.process()
+	}
+	return t
+}
+
+// Quantile returns the approximate value at the given quantile, q, which must
+// be between 0 and 1. Returns NaN if the digest is empty.
+func (t *TDigest) Quantile(q float64) float64 {
+	t.process()
+	if len(t.centroids) == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	if q == 0 {
+		return t.min
+	}
+	if q == 1 {
+		return t.max
+	}
+	if len(t.centroids) == 1 {
+		return t.centroids[0].mean
+	}
+
+	// Each centroid is centered at the midpoint of its cumulative weight.
+	index := q * t.count
+	first := t.centroids[0]
+	if index < first.weight/2 {
+		return t.min + (first.mean-t.min)*index/(first.weight/2)
+	}
+
+	cumulative := first.weight / 2
+	for i := 0; i < len(t.centroids)-1; i++ {
+		left, right := t.centroids[i], t.centroids[i+1]
+		step := (left.weight + right.weight) / 2
+		if index < cumulative+step {
+			return left.mean + (right.mean-left.mean)*(index-cumulative)/step
+		}
+		cumulative += step
+	}
+
+	last := t.centroids[len(t.centroids)-1]
+	return last.mean + (t.max-last.mean)*math.Min((index-cumulative)/(last.weight/2), 1)
+}
+
+// CDF returns the approximate fraction of values which are less than or equal
+// to x. Returns NaN if the digest is empty.
+func (t *TDigest) CDF(x float64) float64 {
+	t.process()
+	if len(t.centroids) == 0 {
+		return math.NaN()
+	}
+	if x < t.min {
+		return 0
+	}
+	if x >= t.max {
+		return 1
+	}
+
+	first := t.centroids[0]
+	if x < first.mean {
+		if first.mean == t.min {
+			return 0
+		}
+		return first.weight / 2 * (x - t.min) / (first.mean - t.min) / t.count
+	}
+
+	cumulative := first.weight / 2
+	for i := 0; i < len(t.centroids)-1; i++ {
+		left, right := t.centroids[i], t.centroids[i+1]
+		step := (left.weight + right.weight) / 2
+		if x < right.mean {
+			return (cumulative + step*(x-left.mean)/(right.mean-left.mean)) / t.count
+		}
+		cumulative += step
+	}
+
+	last := t.centroids[len(t.centroids)-1]
+	return (cumulative + last.weight/2*(x-last.mean)/(t.max-last.mean)) / t.count
+}
+
+// Merge combines this t-digest with another. The other digest is not
+// modified.
+func (t *TDigest) Merge(other *TDigest) {
+	for _, c := range other.centroids {
+		t.Add(c.mean, c.weight)
+	}
+	for _, c := range other.buffer {
+		t.Add(c.mean, c.weight)
+	}
+
+	// Centroid means are within the range of values, so restore the extremes.
+	if other.min < t.min {
+		t.min = other.min
+	}
+	if other.max > t.max {
+		t.max = other.max
+	}
+}
+
+// Reset restores the TDigest to its original state. It returns itself to
+// allow for chaining.
+func (t *TDigest) Reset() *TDigest {
+	t.centroids = t.centroids[:0]
+	t.buffer = t.buffer[:0]
+	t.count = 0
+	t.min = math.Inf(1)
+	t.max = math.Inf(-1)
+	return t
+}
+
+// process merges the buffered values into the centroids. Adjacent centroids
+// are combined as long as the result stays within one unit of the scale
+// function.
+func (t *TDigest) process() {
+	if len(t.buffer) == 0 {
+		return
+	}
+
+	all := append(t.buffer, t.centroids...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	var (
+		merged = make([]centroid, 0, len(t.centroids)+1)
+		cur    = all[0]
+		soFar  = 0.0
+		limit  = t.count * t.scaleInverse(t.scale(0)+1)
+	)
+	for _, c := range all[1:] {
+		if soFar+cur.weight+c.weight <= limit {
+			cur.weight += c.weight
+			cur.mean += (c.mean - cur.mean) * c.weight / cur.weight
+			continue
+		}
+		soFar += cur.weight
+		merged = append(merged, cur)
+		limit = t.count * t.scaleInverse(t.scale(soFar/t.count)+1)
+		cur = c
+	}
+	merged = append(merged, cur)
+
+	t.centroids = merged
+	t.buffer = t.buffer[:0]
+}
+
+// scale maps the quantile q to the k-scale, which is steeper near the tails.
+func (t *TDigest) scale(q float64) float64 {
+	return t.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// scaleInverse maps the k-scale back to a quantile.
+func (t *TDigest) scaleInverse(k float64) float64 {
+	if k >= t.compression/4 {
+		return 1
+	}
+	return (math.Sin(k*2*math.Pi/t.compression) + 1) / 2
+}
+
+// WriteTo writes a binary representation of the TDigest to an i/o stream.
+// Buffered values are merged first so only the centroids are written. It
+// returns the number of bytes written.
+func (t *TDigest) WriteTo(stream io.Writer) (int64, error) {
+	t.process()
+
+	err := binary.Write(stream, binary.BigEndian, t.compression)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, t.min)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, t.max)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(len(t.centroids)))
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range t.centroids {
+		err = binary.Write(stream, binary.BigEndian, c.mean)
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Write(stream, binary.BigEndian, c.weight)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return int64((4 + 2*len(t.centroids)) * binary.Size(float64(0))), nil
+}
+
+// ReadFrom reads a binary representation of TDigest (such as might have been
+// written by WriteTo()) from an i/o stream. It returns the number of bytes
+// read.
+func (t *TDigest) ReadFrom(stream io.Reader) (int64, error) {
+	var compression, min, max float64
+	var len uint64
+	err := binary.Read(stream, binary.BigEndian, &compression)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &min)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &max)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &len)
+	if err != nil {
+		return 0, err
+	}
+	var count float64
+	centroids := make([]centroid, len)
+	for i := range centroids {
+		err = binary.Read(stream, binary.BigEndian, &centroids[i].mean)
+		if err != nil {
+			return 0, err
+		}
+		err = binary.Read(stream, binary.BigEndian, &centroids[i].weight)
+		if err != nil {
+			return 0, err
+		}
+		count += centroids[i].weight
+	}
+
+	t.compression = compression
+	t.min = min
+	t.max = max
+	t.count = count
+	t.centroids = centroids
+	t.buffer = make([]centroid, 0, tDigestBufferSize(compression))
+	return int64((4 + 2*len) * uint64(binary.Size(float64(0)))), nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (t *TDigest) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := t.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (t *TDigest) GobDecode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := t.ReadFrom(buf)
+
+	return err
+}
+
+// tDigestBufferSize returns the number of values to buffer before merging
+// them into the centroids for the given compression factor.
+func tDigestBufferSize(compression float64) int {
+	return int(math.Ceil(compression * 5))
+}
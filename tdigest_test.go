@@ -0,0 +1,179 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Ensures that Quantile returns accurate approximations for a uniform
+// distribution.
+func TestTDigestQuantile(t *testing.T) {
+	d := NewDefaultTDigest()
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		if d.Add(r.Float64(), 1) != d {
+			t.Fatal("Returned TDigest should be the same instance")
+		}
+	}
+
+	if count := d.Count(); count != 100000 {
+		t.Errorf("expected 100000, got %f", count)
+	}
+
+	for _, q := range []float64{0.001, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999} {
+		if actual := d.Quantile(q); math.Abs(actual-q) > 0.01 {
+			t.Errorf("expected about %f, got %f", q, actual)
+		}
+	}
+
+	if min := d.Quantile(0); min != d.Min() {
+		t.Errorf("expected %f, got %f", d.Min(), min)
+	}
+
+	if max := d.Quantile(1); max != d.Max() {
+		t.Errorf("expected %f, got %f", d.Max(), max)
+	}
+
+	if len(d.centroids) > 2*int(d.Compression()) {
+		t.Errorf("expected at most %d centroids, got %d", 2*int(d.Compression()), len(d.centroids))
+	}
+}
+
+// Ensures that CDF returns accurate approximations for a uniform
+// distribution.
+func TestTDigestCDF(t *testing.T) {
+	d := NewDefaultTDigest()
+	if !math.IsNaN(d.CDF(0.5)) || !math.IsNaN(d.Quantile(0.5)) {
+		t.Error("expected NaN for empty digest")
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		d.Add(r.Float64()*100, 1)
+	}
+
+	for _, x := range []float64{0.1, 1, 10, 50, 90, 99, 99.9} {
+		if actual := d.CDF(x); math.Abs(actual-x/100) > 0.01 {
+			t.Errorf("expected about %f, got %f", x/100, actual)
+		}
+	}
+
+	if cdf := d.CDF(-1); cdf != 0 {
+		t.Errorf("expected 0, got %f", cdf)
+	}
+
+	if cdf := d.CDF(100); cdf != 1 {
+		t.Errorf("expected 1, got %f", cdf)
+	}
+}
+
+// Ensures that weighted values are accounted for.
+func TestTDigestWeights(t *testing.T) {
+	d := NewDefaultTDigest()
+	d.Add(1, 90).Add(100, 10).Add(math.NaN(), 1).Add(50, 0)
+
+	if count := d.Count(); count != 100 {
+		t.Errorf("expected 100, got %f", count)
+	}
+
+	if median := d.Quantile(0.5); median > 50 {
+		t.Errorf("expected less than 50, got %f", median)
+	}
+
+	if p95 := d.Quantile(0.95); p95 < 50 {
+		t.Errorf("expected at least 50, got %f", p95)
+	}
+}
+
+// Ensures that Merge combines the digests.
+func TestTDigestMerge(t *testing.T) {
+	d, merged := NewDefaultTDigest(), NewDefaultTDigest()
+	for i := 0; i < 10; i++ {
+		d.Reset()
+		for j := 0; j < 10000; j++ {
+			d.Add(float64(i*10000+j), 1)
+		}
+		d.Quantile(0.5)
+		merged.Merge(d)
+	}
+
+	if count := merged.Count(); count != 100000 {
+		t.Errorf("expected 100000, got %f", count)
+	}
+
+	if min, max := merged.Min(), merged.Max(); min != 0 || max != 99999 {
+		t.Errorf("expected 0 and 99999, got %f and %f", min, max)
+	}
+
+	for _, q := range []float64{0.01, 0.5, 0.99} {
+		if actual := merged.Quantile(q); math.Abs(actual-q*100000) > 1000 {
+			t.Errorf("expected about %f, got %f", q*100000, actual)
+		}
+	}
+}
+
+// Ensures that Reset restores the digest to its original state.
+func TestTDigestReset(t *testing.T) {
+	d := NewDefaultTDigest()
+	for i := 0; i < 1000; i++ {
+		d.Add(float64(i), 1)
+	}
+
+	if d.Reset() != d {
+		t.Error("Returned TDigest should be the same instance")
+	}
+
+	if count := d.Count(); count != 0 {
+		t.Errorf("expected 0, got %f", count)
+	}
+
+	if q := d.Quantile(0.5); !math.IsNaN(q) {
+		t.Errorf("expected NaN, got %f", q)
+	}
+}
+
+// Ensures that TDigest can be serialized and deserialized without errors.
+func TestTDigestSerialization(t *testing.T) {
+	d := NewDefaultTDigest()
+	for i := 0; i < 10000; i++ {
+		d.Add(float64(i), 1)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(d); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &TDigest{}
+	if err := gob.NewDecoder(&buf).Decode(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, q := range []float64{0, 0.01, 0.5, 0.99, 1} {
+		if expected, actual := d.Quantile(q), decoded.Quantile(q); expected != actual {
+			t.Errorf("expected %f, got %f", expected, actual)
+		}
+	}
+
+	if count := decoded.Count(); count != 10000 {
+		t.Errorf("expected 10000, got %f", count)
+	}
+
+	decoded.Add(10000, 1)
+	if max := decoded.Max(); max != 10000 {
+		t.Errorf("expected 10000, got %f", max)
+	}
+}
+
+func BenchmarkTDigestAdd(b *testing.B) {
+	d := NewDefaultTDigest()
+	r := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		d.Add(r.Float64(), 1)
+	}
+}
@@ -0,0 +1,324 @@
+package boom
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"io"
+	"math"
+	"sort"
+)
+
+// hashHeap is a max-heap of hash values.
+type hashHeap []uint64
+
+func (h hashHeap) Len() int           { return len(h) }
+func (h hashHeap) Less(i, j int) bool { return h[i] > h[j] }
+func (h hashHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *hashHeap) Push(x interface{}) {
+	*h = append(*h, x.(uint64))
+}
+
+func (h *hashHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+// ThetaSketch implements a K Minimum Values (KMV) sketch generalized to the
+// Theta Sketch Framework as described by Dasgupta, Lang, Rhodes, and Thaler
+// in A Framework for Estimating Stream Expression Cardinalities:
+//
+// https://arxiv.org/abs/1510.01455
+//
+// A Theta Sketch approximates the number of distinct elements in a multiset by
+// retaining the hash values which fall below a threshold, theta. Hash values
+// are treated as uniformly distributed over the unit interval, so if the
+// sketch retains count hashes below theta, the estimated cardinality is
+// count / theta. Once more than k hashes are retained, theta is lowered to the
+// largest retained hash, which is then discarded.
+//
+// Unlike HyperLogLog, the retained hashes are themselves a uniform sample of
+// the distinct elements, which means Theta Sketches support true set algebra.
+// Union, Intersect, and AnotB produce new sketches which can be estimated,
+// serialized, and combined further. For counting element frequency, refer to
+// the Count-Min Sketch.
+type ThetaSketch struct {
+	entries map[uint64]struct{} // retained hash values
+	heap    *hashHeap           // retained hash values ordered by max
+	k       uint                // nominal number of entries
+	theta   uint64              // hash threshold
+	hash    hash.Hash64         // hash function
+}
+
+// NewThetaSketch creates a new Theta Sketch which retains at most k hash
+// values. The relative standard error of the estimate is roughly 1/sqrt(k).
+func NewThetaSketch(k uint) *ThetaSketch {
+	if k == 0 {
+		k = 1
+	}
+	h := make(hashHeap, 0, k+1)
+	return &ThetaSketch{
+		entries: make(map[uint64]struct{}, k+1),
+		heap:    &h,
+		k:       k,
+		theta:   math.MaxUint64,
+		hash:    fnv.New64a(),
+	}
+}
+
+// NewDefaultThetaSketch creates a new Theta Sketch optimized for the specified
+// relative standard error.
+func NewDefaultThetaSketch(e float64) *ThetaSketch {
+	return NewThetaSketch(uint(math.Ceil(1 / (e * e))))
+}
+
+// K returns the nominal number of entries retained by the sketch.
+func (t *ThetaSketch) K() uint {
+	return t.k
+}
+
+// Retained returns the number of hash values currently retained.
+func (t *ThetaSketch) Retained() uint {
+	return uint(len(t.entries))
+}
+
+// Theta returns the current threshold as a fraction of the hash space. It is
+// 1 until more than k distinct elements have been added.
+func (t *ThetaSketch) Theta() float64 {
+	if t.theta == math.MaxUint64 {
+		return 1
+	}
+	return float64(t.theta) / float64(math.MaxUint64)
+}
+
+// Add will add the data to the set. Returns the ThetaSketch to allow for
+// chaining.
+func (t *ThetaSketch) Add(data []byte) *ThetaSketch {
+	t.hash.Write(data)
+	sum := mix64(t.hash.Sum64())
+	t.hash.Reset()
+	t.insert(sum)
+	return t
+}
+
+// Estimate returns the approximated cardinality of the set.
+func (t *ThetaSketch) Estimate() float64 {
+	return float64(len(t.entries)) / t.Theta()
+}
+
+// LowerBound returns the approximate lower bound of the cardinality within
+// the given number of standard deviations. It is never less than the number
+// of retained entries.
+func (t *ThetaSketch) LowerBound(stdDevs float64) float64 {
+	lower := t.Estimate() - stdDevs*t.stdDev()
+	if retained := float64(len(t.entries)); lower < retained {
+		lower = retained
+	}
+	return lower
+}
+
+// UpperBound returns the approximate upper bound of the cardinality within
+// the given number of standard deviations.
+func (t *ThetaSketch) UpperBound(stdDevs float64) float64 {
+	return t.Estimate() + stdDevs*t.stdDev()
+}
+
+// Union returns a new ThetaSketch representing the union of this sketch and
+// another. Neither sketch is modified. The result retains at most the smaller
+// k of the two sketches. Both sketches must use the same hash function.
+func (t *ThetaSketch) Union(other *ThetaSketch) *ThetaSketch {
+	k := t.k
+	if other.k < k {
+		k = other.k
+	}
+	result := t.result(k, other)
+	for hash := range t.entries {
+		result.insert(hash)
+	}
+	for hash := range other.entries {
+		result.insert(hash)
+	}
+	return result
+}
+
+// Intersect returns a new ThetaSketch representing the intersection of this
+// sketch and another. Neither sketch is modified. Both sketches must use the
+// same hash function.
+func (t *ThetaSketch) Intersect(other *ThetaSketch) *ThetaSketch {
+	result := t.result(t.k, other)
+	for hash := range t.entries {
+		if _, ok := other.entries[hash]; ok {
+			result.insert(hash)
+		}
+	}
+	return result
+}
+
+// AnotB returns a new ThetaSketch representing the elements in this sketch
+// which are not in the other. Neither sketch is modified. Both sketches must
+// use the same hash function.
+func (t *ThetaSketch) AnotB(other *ThetaSketch) *ThetaSketch {
+	result := t.result(t.k, other)
+	for hash := range t.entries {
+		if _, ok := other.entries[hash]; !ok {
+			result.insert(hash)
+		}
+	}
+	return result
+}
+
+// Reset restores the ThetaSketch to its original state. It returns itself to
+// allow for chaining.
+func (t *ThetaSketch) Reset() *ThetaSketch {
+	h := make(hashHeap, 0, t.k+1)
+	t.entries = make(map[uint64]struct{}, t.k+1)
+	t.heap = &h
+	t.theta = math.MaxUint64
+	return t
+}
+
+// SetHash sets the hashing function used.
+func (t *ThetaSketch) SetHash(h hash.Hash64) {
+	t.hash = h
+}
+
+// insert retains the hash value if it falls below theta, lowering theta and
+// discarding the largest value if more than k values are retained.
+func (t *ThetaSketch) insert(hash uint64) {
+	if hash >= t.theta {
+		return
+	}
+	if _, ok := t.entries[hash]; ok {
+		return
+	}
+
+	t.entries[hash] = struct{}{}
+	heap.Push(t.heap, hash)
+
+	if uint(len(t.entries)) > t.k {
+		t.theta = heap.Pop(t.heap).(uint64)
+		delete(t.entries, t.theta)
+	}
+}
+
+// result returns an empty ThetaSketch with k entries, sharing the hash
+// function of this sketch, and the smaller theta of this sketch and another.
+func (t *ThetaSketch) result(k uint, other *ThetaSketch) *ThetaSketch {
+	result := NewThetaSketch(k)
+	result.hash = t.hash
+	result.theta = t.theta
+	if other.theta < result.theta {
+		result.theta = other.theta
+	}
+	return result
+}
+
+// stdDev returns the approximate standard deviation of the estimate. Each
+// distinct element is retained with probability theta, so the retained count
+// is binomially distributed.
+func (t *ThetaSketch) stdDev() float64 {
+	theta := t.Theta()
+	return math.Sqrt(float64(len(t.entries))*(1-theta)) / theta
+}
+
+// WriteTo writes a binary representation of the ThetaSketch to an i/o stream.
+// It returns the number of bytes written.
+func (t *ThetaSketch) WriteTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, uint64(t.k))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, t.theta)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(len(t.entries)))
+	if err != nil {
+		return 0, err
+	}
+
+	// Write the entries sorted so the encoding is deterministic.
+	entries := make([]uint64, 0, len(t.entries))
+	for hash := range t.entries {
+		entries = append(entries, hash)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i] < entries[j] })
+	err = binary.Write(stream, binary.BigEndian, entries)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64((3 + len(entries)) * binary.Size(uint64(0))), nil
+}
+
+// ReadFrom reads a binary representation of ThetaSketch (such as might have
+// been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (t *ThetaSketch) ReadFrom(stream io.Reader) (int64, error) {
+	var k, theta, len uint64
+	err := binary.Read(stream, binary.BigEndian, &k)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &theta)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &len)
+	if err != nil {
+		return 0, err
+	}
+	entries := make([]uint64, len)
+	err = binary.Read(stream, binary.BigEndian, entries)
+	if err != nil {
+		return 0, err
+	}
+
+	t.k = uint(k)
+	t.Reset()
+	t.theta = theta
+	for _, hash := range entries {
+		t.entries[hash] = struct{}{}
+		heap.Push(t.heap, hash)
+	}
+	if t.hash == nil {
+		t.hash = fnv.New64a()
+	}
+	return int64((3 + len) * uint64(binary.Size(uint64(0)))), nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (t *ThetaSketch) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := t.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (t *ThetaSketch) GobDecode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := t.ReadFrom(buf)
+
+	return err
+}
+
+// mix64 applies the MurmurHash3 finalizer to the hash value so that every
+// input bit affects the high-order bits, which the minimum values depend on.
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
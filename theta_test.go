@@ -0,0 +1,163 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"strconv"
+	"testing"
+)
+
+// Ensures that Estimate is exact until more than k elements are added.
+func TestThetaSketchExact(t *testing.T) {
+	s := NewThetaSketch(1024)
+	for i := 0; i < 500; i++ {
+		s.Add([]byte(strconv.Itoa(i))).Add([]byte(strconv.Itoa(i)))
+	}
+
+	if estimate := s.Estimate(); estimate != 500 {
+		t.Errorf("expected 500, got %f", estimate)
+	}
+
+	if theta := s.Theta(); theta != 1 {
+		t.Errorf("expected 1, got %f", theta)
+	}
+
+	if lower, upper := s.LowerBound(2), s.UpperBound(2); lower != 500 || upper != 500 {
+		t.Errorf("expected bounds of 500, got %f and %f", lower, upper)
+	}
+}
+
+// Ensures that Estimate returns an approximation within the error bounds.
+func TestThetaSketchEstimate(t *testing.T) {
+	s := NewDefaultThetaSketch(0.02)
+	if k := s.K(); k != 2500 {
+		t.Errorf("expected 2500, got %d", k)
+	}
+
+	for i := 0; i < 100000; i++ {
+		s.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if retained := s.Retained(); retained != s.K() {
+		t.Errorf("expected %d, got %d", s.K(), retained)
+	}
+
+	estimate := s.Estimate()
+	if math.Abs(estimate-100000)/100000 > 0.06 {
+		t.Errorf("expected about 100000, got %f", estimate)
+	}
+
+	if lower, upper := s.LowerBound(3), s.UpperBound(3); lower > 100000 || upper < 100000 {
+		t.Errorf("expected 100000 within bounds, got %f and %f", lower, upper)
+	}
+}
+
+// Ensures that Union, Intersect, and AnotB return sketches approximating the
+// respective set operations.
+func TestThetaSketchSetOperations(t *testing.T) {
+	a, b := NewThetaSketch(4096), NewThetaSketch(4096)
+	for i := 0; i < 100000; i++ {
+		a.Add([]byte(strconv.Itoa(i)))
+		b.Add([]byte(strconv.Itoa(i + 75000)))
+	}
+
+	tests := []struct {
+		name     string
+		sketch   *ThetaSketch
+		expected float64
+	}{
+		{"union", a.Union(b), 175000},
+		{"intersect", a.Intersect(b), 25000},
+		{"anotb", a.AnotB(b), 75000},
+		{"nested", a.Union(b).AnotB(a), 75000},
+	}
+
+	for _, test := range tests {
+		estimate := test.sketch.Estimate()
+		if math.Abs(estimate-test.expected)/test.expected > 0.1 {
+			t.Errorf("%s: expected about %f, got %f", test.name, test.expected, estimate)
+		}
+	}
+
+	if estimate := a.Intersect(NewThetaSketch(4096)).Estimate(); estimate != 0 {
+		t.Errorf("expected 0, got %f", estimate)
+	}
+}
+
+// Ensures that Reset restores the sketch to its original state.
+func TestThetaSketchReset(t *testing.T) {
+	s := NewThetaSketch(100)
+	for i := 0; i < 1000; i++ {
+		s.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if s.Reset() != s {
+		t.Error("Returned ThetaSketch should be the same instance")
+	}
+
+	if estimate := s.Estimate(); estimate != 0 {
+		t.Errorf("expected 0, got %f", estimate)
+	}
+
+	if theta := s.Theta(); theta != 1 {
+		t.Errorf("expected 1, got %f", theta)
+	}
+}
+
+// Ensures that ThetaSketch can be serialized and deserialized and the result
+// can be combined with other sketches.
+func TestThetaSketchSerialization(t *testing.T) {
+	a, b := NewThetaSketch(1024), NewThetaSketch(1024)
+	for i := 0; i < 10000; i++ {
+		a.Add([]byte(strconv.Itoa(i)))
+		b.Add([]byte(strconv.Itoa(i + 5000)))
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(a.Intersect(b)); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &ThetaSketch{}
+	if err := gob.NewDecoder(&buf).Decode(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, estimate := a.Intersect(b).Estimate(), decoded.Estimate(); expected != estimate {
+		t.Errorf("expected %f, got %f", expected, estimate)
+	}
+
+	wn, err := a.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded = NewThetaSketch(1)
+	rn, err := decoded.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wn != rn {
+		t.Errorf("expected %d bytes read, got %d", wn, rn)
+	}
+
+	if expected, estimate := a.Union(b).Estimate(), decoded.Union(b).Estimate(); expected != estimate {
+		t.Errorf("expected %f, got %f", expected, estimate)
+	}
+}
+
+func BenchmarkThetaSketchAdd(b *testing.B) {
+	b.StopTimer()
+	s := NewThetaSketch(4096)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		s.Add(data[n])
+	}
+}
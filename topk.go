@@ -1,22 +1,35 @@
 package boom
 
 import (
-	"bytes"
 	"container/heap"
+	"sort"
 )
 
 // Element represents a data and it's frequency
 type Element struct {
 	Data []byte
 	Freq uint64
+	// Error is the maximum overestimation of Freq for summaries which track
+	// it, such as SpaceSaving. It's zero otherwise.
+	Error uint64
+
+	// score orders elements of equal frequency in a heap. Summaries whose
+	// frequencies are derived from a score, such as DecayingTopK, leave Freq
+	// unset in their heaps so they are ordered by score alone.
+	score float64
 }
 
 // An elementHeap is a min-heap of elements.
 type elementHeap []*Element
 
-func (e elementHeap) Len() int           { return len(e) }
-func (e elementHeap) Less(i, j int) bool { return e[i].Freq < e[j].Freq }
-func (e elementHeap) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e elementHeap) Len() int { return len(e) }
+func (e elementHeap) Less(i, j int) bool {
+	if e[i].Freq != e[j].Freq {
+		return e[i].Freq < e[j].Freq
+	}
+	return e[i].score < e[j].score
+}
+func (e elementHeap) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
 
 func (e *elementHeap) Push(x interface{}) {
 	*e = append(*e, x.(*Element))
@@ -30,68 +43,244 @@ func (e *elementHeap) Pop() interface{} {
 	return x
 }
 
+// An indexedHeap is a min-heap of elements which also indexes each element's
+// position by its data, so an element can be found and updated in O(log k).
+type indexedHeap struct {
+	elements elementHeap
+	index    map[string]int
+}
+
+// newIndexedHeap creates a new indexedHeap with capacity for k elements.
+func newIndexedHeap(k uint) *indexedHeap {
+	return &indexedHeap{
+		elements: make(elementHeap, 0, k),
+		index:    make(map[string]int, k),
+	}
+}
+
+func (e *indexedHeap) Len() int           { return len(e.elements) }
+func (e *indexedHeap) Less(i, j int) bool { return e.elements.Less(i, j) }
+
+func (e *indexedHeap) Swap(i, j int) {
+	e.elements.Swap(i, j)
+	e.index[string(e.elements[i].Data)] = i
+	e.index[string(e.elements[j].Data)] = j
+}
+
+func (e *indexedHeap) Push(x interface{}) {
+	element := x.(*Element)
+	e.index[string(element.Data)] = len(e.elements)
+	e.elements = append(e.elements, element)
+}
+
+func (e *indexedHeap) Pop() interface{} {
+	element := e.elements.Pop().(*Element)
+	delete(e.index, string(element.Data))
+	return element
+}
+
+// min returns the element with the minimum frequency.
+func (e *indexedHeap) min() *Element {
+	return e.elements[0]
+}
+
+// update sets the frequency of the element with the given data, adding it if
+// it isn't already in the heap. If the heap is full, the element with the
+// minimum frequency is removed to make room and returned. The data is stored
+// as is.
+func (e *indexedHeap) update(data []byte, freq uint64, k uint) *Element {
+	return e.updateScore(data, freq, 0, k)
+}
+
+// updateScore is like update, but also sets the score of the element.
+func (e *indexedHeap) updateScore(data []byte, freq uint64, score float64, k uint) *Element {
+	if i, ok := e.index[string(data)]; ok {
+		// Element already in the heap, replace it with new frequency.
+		element := heap.Remove(e, i).(*Element)
+		element.Freq = freq
+		element.score = score
+		heap.Push(e, element)
+		return nil
+	}
+
+	var evicted *Element
+	if e.Len() == int(k) {
+		// Remove minimum-frequency element.
+		evicted = heap.Pop(e).(*Element)
+	}
+
+	heap.Push(e, &Element{Data: data, Freq: freq, score: score})
+	return evicted
+}
+
+// sorted returns the elements from lowest to highest frequency.
+func (e *indexedHeap) sorted() []*Element {
+	elements := make(elementHeap, e.Len())
+	copy(elements, e.elements)
+	heap.Init(&elements)
+	sorted := make([]*Element, 0, e.Len())
+
+	for elements.Len() > 0 {
+		sorted = append(sorted, heap.Pop(&elements).(*Element))
+	}
+
+	return sorted
+}
+
+// TopKChangeKind is the kind of change to the top-k elements.
+type TopKChangeKind int
+
+const (
+	// ElementEntered indicates that an element entered the top-k.
+	ElementEntered TopKChangeKind = iota
+
+	// ElementLeft indicates that an element left the top-k.
+	ElementLeft
+
+	// ElementRankChanged indicates that the rank of an element in the top-k
+	// changed.
+	ElementRankChanged
+)
+
+// TopKChange describes a change to the top-k elements. Rank is 1 for the most
+// frequent element, with ties ranked by data, and 0 if the element is not in
+// the top-k.
+type TopKChange struct {
+	Kind         TopKChangeKind
+	Data         []byte
+	Freq         uint64
+	Rank         int
+	PreviousRank int
+}
+
+// rankedElement is a top-k element's data and estimated frequency as of its
+// last rank change.
+type rankedElement struct {
+	data string
+	freq uint64
+}
+
+// before indicates if the element ranks before the other. Ties are ranked by
+// data so that ranks are stable.
+func (r rankedElement) before(other rankedElement) bool {
+	if r.freq != other.freq {
+		return r.freq > other.freq
+	}
+	return r.data < other.data
+}
+
 // TopK uses a Count-Min Sketch to calculate the top-K frequent elements in a
 // stream.
 type TopK struct {
-	cms      *CountMinSketch
-	k        uint
-	n        uint
-	elements *elementHeap
+	cms       *CountMinSketch
+	k         uint
+	n         uint
+	elements  *indexedHeap
+	listeners []func(TopKChange)
+	ranked    []rankedElement // top-k elements by rank, if listening
+	ranks     map[string]int  // index of each element in ranked
+	changed   []TopKChange    // rank changes buffered by notifyUpdate
 }
 
 // NewTopK creates a new TopK backed by a Count-Min sketch whose relative
 // accuracy is within a factor of epsilon with probability delta. It tracks the
 // k-most frequent elements.
 func NewTopK(epsilon, delta float64, k uint) *TopK {
-	elements := make(elementHeap, 0, k)
-	heap.Init(&elements)
 	return &TopK{
 		cms:      NewCountMinSketch(epsilon, delta),
 		k:        k,
-		elements: &elements,
+		elements: newIndexedHeap(k),
 	}
 }
 
 // Add will add the data to the Count-Min Sketch and update the top-k heap if
 // applicable. Returns the TopK to allow for chaining.
 func (t *TopK) Add(data []byte) *TopK {
-	t.cms.Add(data)
-	t.n++
+	return t.AddN(data, 1)
+}
+
+// AddN will add the data to the Count-Min Sketch n times and update the top-k
+// heap if applicable. Returns the TopK to allow for chaining.
+func (t *TopK) AddN(data []byte, n uint64) *TopK {
+	t.cms.AddN(data, n)
+	t.n += uint(n)
 
 	freq := t.cms.Count(data)
 	if t.isTop(freq) {
-		t.insert(data, freq)
+		evicted := t.insert(data, freq)
+		t.notifyUpdate(data, freq, evicted)
 	}
 
 	return t
 }
 
+// OnChange registers a callback which is invoked when an element enters the
+// top-k, leaves it, or its rank changes. Callbacks are invoked synchronously
+// in the order they were registered, and the changes for a single update are
+// delivered with departures first, then arrivals, then rank changes. Ranks
+// are updated from the element which changed, so an update of the top-k costs
+// O(log k) plus the cost of shifting the elements whose rank changed, while
+// Merge and Reset recompute all ranks in O(k log k).
+func (t *TopK) OnChange(fn func(TopKChange)) {
+	if len(t.listeners) == 0 {
+		t.ranked = t.rank()
+		t.ranks = make(map[string]int, len(t.ranked))
+		for i, element := range t.ranked {
+			t.ranks[element.data] = i
+		}
+	}
+	t.listeners = append(t.listeners, fn)
+}
+
+// Count returns the approximate frequency of the data, which is never
+// underestimated.
+func (t *TopK) Count(data []byte) uint64 {
+	return t.cms.Count(data)
+}
+
 // Elements returns the top-k elements from lowest to highest frequency.
 func (t *TopK) Elements() []*Element {
-	if t.elements.Len() == 0 {
-		return make([]*Element, 0)
+	return t.elements.sorted()
+}
+
+// Merge combines this TopK with another. The Count-Min Sketches are merged and
+// the top-k elements are recomputed from the candidates of both. The other
+// TopK is not modified. Returns an error if the Count-Min Sketches don't have
+// the same dimensions.
+func (t *TopK) Merge(other *TopK) error {
+	if err := t.cms.Merge(other.cms); err != nil {
+		return err
 	}
+	t.n += other.n
 
-	elements := make(elementHeap, t.elements.Len())
-	copy(elements, *t.elements)
-	heap.Init(&elements)
-	topK := make([]*Element, 0, t.k)
+	candidates := make([][]byte, 0, t.elements.Len()+other.elements.Len())
+	for _, element := range t.elements.elements {
+		candidates = append(candidates, element.Data)
+	}
+	for _, element := range other.elements.elements {
+		if _, ok := t.elements.index[string(element.Data)]; !ok {
+			candidates = append(candidates, element.Data)
+		}
+	}
 
-	for elements.Len() > 0 {
-		topK = append(topK, heap.Pop(&elements).(*Element))
+	t.elements = newIndexedHeap(t.k)
+	for _, data := range candidates {
+		if freq := t.cms.Count(data); t.isTop(freq) {
+			t.insert(data, freq)
+		}
 	}
 
-	return topK
+	t.notify()
+	return nil
 }
 
 // Reset restores the TopK to its original state. It returns itself to allow
 // for chaining.
 func (t *TopK) Reset() *TopK {
 	t.cms.Reset()
-	elements := make(elementHeap, 0, t.k)
-	heap.Init(&elements)
-	t.elements = &elements
+	t.elements = newIndexedHeap(t.k)
 	t.n = 0
+	t.notify()
 	return t
 }
 
@@ -101,28 +290,162 @@ func (t *TopK) isTop(freq uint64) bool {
 		return true
 	}
 
-	return freq >= (*t.elements)[0].Freq
+	return freq >= t.elements.min().Freq
 }
 
 // insert adds the data to the top-k heap. If the data is already an element,
 // the frequency is updated. If the heap already has k elements, the element
-// with the minimum frequency is removed.
-func (t *TopK) insert(data []byte, freq uint64) {
-	for i, element := range *t.elements {
-		if bytes.Equal(data, element.Data) {
-			// Element already in top-k, replace it with new frequency.
-			heap.Remove(t.elements, i)
-			element.Freq = freq
-			heap.Push(t.elements, element)
-			return
+// with the minimum frequency is removed and returned.
+func (t *TopK) insert(data []byte, freq uint64) *Element {
+	return t.elements.update(data, freq, t.k)
+}
+
+// notify recomputes the ranks of the top-k elements and invokes the change
+// callbacks for any elements which entered, left, or changed rank.
+func (t *TopK) notify() {
+	if len(t.listeners) == 0 {
+		return
+	}
+
+	var (
+		ranked  = t.rank()
+		ranks   = make(map[string]int, len(ranked))
+		entered = make([]TopKChange, 0)
+		changed = make([]TopKChange, 0)
+	)
+	for i, element := range ranked {
+		ranks[element.data] = i
+	}
+	for i, element := range t.ranked {
+		if _, ok := ranks[element.data]; !ok {
+			t.emit(TopKChange{
+				Kind:         ElementLeft,
+				Data:         []byte(element.data),
+				Freq:         element.freq,
+				PreviousRank: i + 1,
+			})
+		}
+	}
+	for i, element := range ranked {
+		old, ok := t.ranks[element.data]
+		switch {
+		case !ok:
+			entered = append(entered, TopKChange{
+				Kind: ElementEntered,
+				Data: []byte(element.data),
+				Freq: element.freq,
+				Rank: i + 1,
+			})
+		case old != i:
+			changed = append(changed, TopKChange{
+				Kind:         ElementRankChanged,
+				Data:         []byte(element.data),
+				Freq:         element.freq,
+				Rank:         i + 1,
+				PreviousRank: old + 1,
+			})
 		}
 	}
+	t.ranked, t.ranks = ranked, ranks
 
-	if t.elements.Len() == int(t.k) {
-		// Remove minimum-frequency element.
-		heap.Pop(t.elements)
+	for _, change := range append(entered, changed...) {
+		t.emit(change)
+	}
+}
+
+// notifyUpdate updates the ranks after the frequency of the data was set in
+// the top-k heap, which evicted the given element if not nil, and invokes the
+// change callbacks for any elements which entered, left, or changed rank.
+// Removing an element from its rank and inserting it at another only changes
+// the ranks in between, so only those are compared.
+func (t *TopK) notifyUpdate(data []byte, freq uint64, evicted *Element) {
+	if len(t.listeners) == 0 {
+		return
+	}
+
+	var (
+		element = rankedElement{data: string(data), freq: freq}
+		removed = len(t.ranked)
+		left    *TopKChange
+	)
+	if i, ok := t.ranks[element.data]; ok {
+		removed = i
+	} else if evicted != nil {
+		removed = t.ranks[string(evicted.Data)]
+		left = &TopKChange{
+			Kind:         ElementLeft,
+			Data:         []byte(t.ranked[removed].data),
+			Freq:         t.ranked[removed].freq,
+			PreviousRank: removed + 1,
+		}
+		delete(t.ranks, string(evicted.Data))
+	}
+	if removed < len(t.ranked) {
+		t.ranked = append(t.ranked[:removed], t.ranked[removed+1:]...)
+	}
+
+	inserted := sort.Search(len(t.ranked), func(i int) bool {
+		return element.before(t.ranked[i])
+	})
+	t.ranked = append(t.ranked, rankedElement{})
+	copy(t.ranked[inserted+1:], t.ranked[inserted:])
+	t.ranked[inserted] = element
+
+	lo, hi := inserted, removed
+	if lo > hi {
+		lo, hi = hi, lo
 	}
 
-	// Add element to top-k.
-	heap.Push(t.elements, &Element{Data: data, Freq: freq})
+	var entered *TopKChange
+	t.changed = t.changed[:0]
+	for i := lo; i <= hi; i++ {
+		element := t.ranked[i]
+		old, ok := t.ranks[element.data]
+		switch {
+		case !ok:
+			entered = &TopKChange{
+				Kind: ElementEntered,
+				Data: []byte(element.data),
+				Freq: element.freq,
+				Rank: i + 1,
+			}
+		case old != i:
+			t.changed = append(t.changed, TopKChange{
+				Kind:         ElementRankChanged,
+				Data:         []byte(element.data),
+				Freq:         element.freq,
+				Rank:         i + 1,
+				PreviousRank: old + 1,
+			})
+		}
+		t.ranks[element.data] = i
+	}
+
+	if left != nil {
+		t.emit(*left)
+	}
+	if entered != nil {
+		t.emit(*entered)
+	}
+	for _, change := range t.changed {
+		t.emit(change)
+	}
+}
+
+// emit invokes the change callbacks with the change.
+func (t *TopK) emit(change TopKChange) {
+	for _, fn := range t.listeners {
+		fn(change)
+	}
+}
+
+// rank returns the top-k elements by rank. Ties are ranked by data so that
+// ranks are stable.
+func (t *TopK) rank() []rankedElement {
+	ranked := make([]rankedElement, 0, t.elements.Len())
+	for _, element := range t.elements.elements {
+		ranked = append(ranked, rankedElement{data: string(element.Data), freq: element.Freq})
+	}
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].before(ranked[j]) })
+	return ranked
 }
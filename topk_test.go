@@ -1,6 +1,8 @@
 package boom
 
 import (
+	"bytes"
+	"math/rand"
 	"strconv"
 	"testing"
 )
@@ -62,6 +64,186 @@ func TestTopK(t *testing.T) {
 	}
 }
 
+// Ensures that AddN adds the data n times and Count returns its frequency.
+func TestTopKAddN(t *testing.T) {
+	topk := NewTopK(0.001, 0.99, 2)
+
+	if topk.AddN([]byte(`bob`), 3) != topk {
+		t.Error("Returned TopK should be the same instance")
+	}
+	topk.AddN([]byte(`tyler`), 5).AddN([]byte(`alice`), 4).Add([]byte(`bob`))
+
+	expected := []struct {
+		name string
+		freq uint64
+	}{
+		{"bob", 4},
+		{"tyler", 5},
+	}
+
+	actual := topk.Elements()
+	if l := len(actual); l != 2 {
+		t.Fatalf("Expected len %d, got %d", 2, l)
+	}
+
+	for i, element := range actual {
+		if e := string(element.Data); e != expected[i].name {
+			t.Errorf("Expected %s, got %s", expected[i].name, e)
+		}
+		if freq := element.Freq; freq != expected[i].freq {
+			t.Errorf("Expected %d, got %d", expected[i].freq, freq)
+		}
+	}
+
+	if count := topk.Count([]byte(`alice`)); count != 4 {
+		t.Errorf("Expected 4, got %d", count)
+	}
+
+	if n := topk.n; n != 13 {
+		t.Errorf("Expected 13, got %d", n)
+	}
+}
+
+// Ensures that Merge combines the frequencies of both TopKs and recomputes the
+// top-k elements.
+func TestTopKMerge(t *testing.T) {
+	a := NewTopK(0.001, 0.99, 2)
+	a.AddN([]byte(`bob`), 3).AddN([]byte(`tyler`), 5).AddN([]byte(`alice`), 1)
+
+	b := NewTopK(0.001, 0.99, 2)
+	b.AddN([]byte(`alice`), 6).AddN([]byte(`fred`), 4).AddN([]byte(`bob`), 1)
+
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		name string
+		freq uint64
+	}{
+		{"tyler", 5},
+		{"alice", 7},
+	}
+
+	actual := a.Elements()
+	if l := len(actual); l != 2 {
+		t.Fatalf("Expected len %d, got %d", 2, l)
+	}
+
+	for i, element := range actual {
+		if e := string(element.Data); e != expected[i].name {
+			t.Errorf("Expected %s, got %s", expected[i].name, e)
+		}
+		if freq := element.Freq; freq != expected[i].freq {
+			t.Errorf("Expected %d, got %d", expected[i].freq, freq)
+		}
+	}
+
+	if count := a.Count([]byte(`bob`)); count != 4 {
+		t.Errorf("Expected 4, got %d", count)
+	}
+
+	if n := a.n; n != 20 {
+		t.Errorf("Expected 20, got %d", n)
+	}
+
+	if err := a.Merge(NewTopK(0.1, 0.99, 2)); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+// Ensures that OnChange callbacks are invoked when elements enter or leave the
+// top-k or change rank.
+func TestTopKOnChange(t *testing.T) {
+	topk := NewTopK(0.001, 0.99, 2)
+	topk.AddN([]byte(`bob`), 3)
+
+	var changes []TopKChange
+	topk.OnChange(func(change TopKChange) {
+		changes = append(changes, change)
+	})
+
+	topk.AddN([]byte(`alice`), 2)
+	topk.AddN([]byte(`tyler`), 5)
+	topk.Add([]byte(`tyler`))
+	topk.AddN([]byte(`alice`), 5)
+	topk.Reset()
+
+	expected := []TopKChange{
+		{ElementEntered, []byte(`alice`), 2, 2, 0},
+		{ElementLeft, []byte(`alice`), 2, 0, 2},
+		{ElementEntered, []byte(`tyler`), 5, 1, 0},
+		{ElementRankChanged, []byte(`bob`), 3, 2, 1},
+		{ElementLeft, []byte(`bob`), 3, 0, 2},
+		{ElementEntered, []byte(`alice`), 7, 1, 0},
+		{ElementRankChanged, []byte(`tyler`), 6, 2, 1},
+		{ElementLeft, []byte(`alice`), 7, 0, 1},
+		{ElementLeft, []byte(`tyler`), 6, 0, 2},
+	}
+
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %d", len(expected), len(changes))
+	}
+
+	for i, change := range changes {
+		e := expected[i]
+		if change.Kind != e.Kind || !bytes.Equal(change.Data, e.Data) || change.Freq != e.Freq ||
+			change.Rank != e.Rank || change.PreviousRank != e.PreviousRank {
+			t.Errorf("Expected %v, got %v", e, change)
+		}
+	}
+}
+
+// Ensures that the ranks delivered to OnChange callbacks as elements are added
+// match the ranks of the top-k elements recomputed from scratch.
+func TestTopKOnChangeRanks(t *testing.T) {
+	var (
+		topk  = NewTopK(0.001, 0.99, 10)
+		rng   = rand.New(NewRandSource(42))
+		ranks = make(map[string]int)
+	)
+	topk.OnChange(func(change TopKChange) {
+		if ranks[string(change.Data)] != change.PreviousRank {
+			t.Fatalf("Expected previous rank %d for %s, got %d",
+				ranks[string(change.Data)], change.Data, change.PreviousRank)
+		}
+		if change.Kind == ElementLeft {
+			delete(ranks, string(change.Data))
+		} else {
+			ranks[string(change.Data)] = change.Rank
+		}
+	})
+
+	for i := 0; i < 10000; i++ {
+		topk.Add([]byte(strconv.Itoa(int(rng.ExpFloat64() * 10))))
+
+		expected := topk.rank()
+		if len(ranks) != len(expected) {
+			t.Fatalf("Expected %d ranks, got %d", len(expected), len(ranks))
+		}
+		for rank, element := range expected {
+			if ranks[element.data] != rank+1 {
+				t.Fatalf("Expected rank %d for %s, got %d", rank+1, element.data, ranks[element.data])
+			}
+		}
+	}
+}
+
+func BenchmarkTopKAddOnChange(b *testing.B) {
+	b.StopTimer()
+	topk := NewTopK(0.001, 0.99, 100)
+	topk.OnChange(func(TopKChange) {})
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i % 1000))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		topk.Add(data[n])
+	}
+}
+
 func BenchmarkTopKAdd(b *testing.B) {
 	b.StopTimer()
 	topk := NewTopK(0.001, 0.99, 5)
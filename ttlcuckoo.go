@@ -0,0 +1,418 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"io"
+	"math/rand"
+	"time"
+)
+
+const (
+	// ttlCuckooStampBits is the width of the epoch stamped on each entry.
+	ttlCuckooStampBits = 8
+
+	// ttlCuckooPrecision is the number of epochs per time-to-live.
+	ttlCuckooPrecision = 16
+
+	// ttlCuckooCompaction is the number of buckets compacted per insertion.
+	ttlCuckooCompaction = 2
+)
+
+// TTLCuckooFilter implements a Cuckoo Filter whose entries expire after a
+// time-to-live. Time is divided into epochs of a sixteenth of the
+// time-to-live, and each fingerprint is stored alongside a coarse stamp of the
+// epoch it was added in. An entry expires between one time-to-live and
+// one time-to-live plus an epoch after it was last added, after which Test
+// ignores it.
+//
+// Expired entries are reclaimed gradually by compacting a few buckets on
+// every insertion, all at once by Sweep, and whenever an insertion finds the
+// filter full. Since stamps wrap around, every expired entry is also swept
+// once every eight time-to-lives. Like the Cuckoo Filter, elements can be
+// removed before they expire.
+type TTLCuckooFilter struct {
+	filter   *CuckooFilter    // fingerprints with the epoch they were added in
+	ttl      time.Duration    // time-to-live of entries
+	interval time.Duration    // epoch length
+	epoch    uint64           // current epoch
+	started  time.Time        // start of the current epoch
+	swept    uint64           // epoch of the last sweep
+	cursor   uint             // next bucket to compact
+	clock    func() time.Time // current time
+}
+
+// NewTTLCuckooFilter creates a new TTL Cuckoo Filter optimized to store n
+// items at a time with the given time-to-live and a specified target
+// false-positive rate.
+func NewTTLCuckooFilter(n uint, ttl time.Duration, fpRate float64) *TTLCuckooFilter {
+	interval := (ttl + ttlCuckooPrecision - 1) / ttlCuckooPrecision
+	if interval <= 0 {
+		interval = 1
+	}
+
+	return &TTLCuckooFilter{
+		filter:   NewCuckooFilter(n, fpRate).withValues(ttlCuckooStampBits),
+		ttl:      ttl,
+		interval: interval,
+		started:  time.Now(),
+		clock:    time.Now,
+	}
+}
+
+// TTL returns the time-to-live of entries.
+func (t *TTLCuckooFilter) TTL() time.Duration {
+	return t.ttl
+}
+
+// Capacity returns the number of items the filter can store at a time.
+func (t *TTLCuckooFilter) Capacity() uint {
+	return t.filter.Capacity()
+}
+
+// Count returns the number of items in the filter, including expired items
+// which haven't been reclaimed yet.
+func (t *TTLCuckooFilter) Count() uint {
+	return t.filter.Count()
+}
+
+// MemoryUsage returns the number of bytes used to store the fingerprints and
+// their stamps.
+func (t *TTLCuckooFilter) MemoryUsage() uint {
+	return t.filter.MemoryUsage()
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member which hasn't expired, false if not. This is a probabilistic test,
+// meaning there is a non-zero probability of false positives.
+func (t *TTLCuckooFilter) Test(data []byte) bool {
+	t.advance()
+	i1, i2, f := t.filter.components(data)
+	for _, i := range t.filter.candidates(i1, i2) {
+		if t.indexOfLive(i, f) != -1 {
+			return true
+		}
+	}
+	return t.stashIndexOfLive(i1, i2, f) != -1
+}
+
+// Add will add the data to the filter, or restart its time-to-live if it's
+// already a member. If the filter is full, expired entries are swept before
+// giving up. ErrFilterFull is returned if the filter is still full, in which
+// case the filter is left unchanged.
+func (t *TTLCuckooFilter) Add(data []byte) error {
+	t.advance()
+	t.compact()
+
+	var (
+		i1, i2, f = t.filter.components(data)
+		stamp     = t.stamp()
+	)
+
+	// Restart the time-to-live of an existing entry, even an expired one.
+	for _, i := range t.filter.candidates(i1, i2) {
+		if j := t.filter.indexOf(i, f); j != -1 {
+			t.filter.put(i, uint(j), f, stamp)
+			return nil
+		}
+	}
+	if idx := t.filter.stashIndexOf(i1, i2, f); idx != -1 {
+		t.filter.stash[idx].v = stamp
+		return nil
+	}
+
+	err := t.filter.add(i1, i2, f, stamp)
+	if err == ErrFilterFull && t.sweep() > 0 {
+		err = t.filter.add(i1, i2, f, stamp)
+	}
+	return err
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member which hasn't expired, false if not. ErrFilterFull is
+// returned if the data couldn't be added.
+func (t *TTLCuckooFilter) TestAndAdd(data []byte) (bool, error) {
+	member := t.Test(data)
+	return member, t.Add(data)
+}
+
+// TestAndRemove will test for membership of the data and remove it from the
+// filter if it exists and hasn't expired. Returns true if the data was a
+// member, false if not.
+func (t *TTLCuckooFilter) TestAndRemove(data []byte) bool {
+	t.advance()
+	i1, i2, f := t.filter.components(data)
+
+	// Try to remove from the stash.
+	if idx := t.stashIndexOfLive(i1, i2, f); idx != -1 {
+		t.filter.stash = append(t.filter.stash[:idx], t.filter.stash[idx+1:]...)
+		t.filter.count--
+		return true
+	}
+
+	for _, i := range t.filter.candidates(i1, i2) {
+		if j := t.indexOfLive(i, f); j != -1 {
+			t.filter.put(i, uint(j), 0, 0)
+			t.filter.count--
+			t.filter.unstash()
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sweep reclaims every expired entry. It returns the number of entries
+// reclaimed.
+func (t *TTLCuckooFilter) Sweep() uint {
+	t.advance()
+	return t.sweep()
+}
+
+// Reset restores the filter to its original state. It returns the filter to
+// allow for chaining.
+func (t *TTLCuckooFilter) Reset() *TTLCuckooFilter {
+	t.filter.Reset()
+	t.epoch = 0
+	t.started = t.clock()
+	t.swept = 0
+	t.cursor = 0
+	return t
+}
+
+// stamp returns the stamp of the current epoch.
+func (t *TTLCuckooFilter) stamp() uint32 {
+	return uint32(t.epoch) & (1<<ttlCuckooStampBits - 1)
+}
+
+// live indicates if an entry with the given stamp hasn't expired.
+func (t *TTLCuckooFilter) live(stamp uint32) bool {
+	age := (t.stamp() - stamp) & (1<<ttlCuckooStampBits - 1)
+	return age <= ttlCuckooPrecision
+}
+
+// indexOfLive returns the entry index of the given fingerprint in the bucket
+// for hash value i if it hasn't expired or -1 if there is no such entry.
+func (t *TTLCuckooFilter) indexOfLive(i uint, f uint32) int {
+	for j := uint(0); j < t.filter.b; j++ {
+		if t.filter.entry(i, j) == f && t.live(t.filter.value(i, j)) {
+			return int(j)
+		}
+	}
+	return -1
+}
+
+// stashIndexOfLive returns the index of the given fingerprint in the stash for
+// either of the hash values if it hasn't expired or -1 if there is no such
+// entry.
+func (t *TTLCuckooFilter) stashIndexOfLive(i1, i2 uint, f uint32) int {
+	for idx, entry := range t.filter.stash {
+		if t.filter.stashMatches(idx, i1, i2, f) && t.live(entry.v) {
+			return idx
+		}
+	}
+	return -1
+}
+
+// advance starts a new epoch for each interval which has elapsed. If stamps
+// are about to wrap around, expired entries are swept so they can't appear
+// live again.
+func (t *TTLCuckooFilter) advance() {
+	elapsed := t.clock().Sub(t.started)
+	if elapsed < t.interval {
+		return
+	}
+
+	epochs := elapsed / t.interval
+	t.started = t.started.Add(epochs * t.interval)
+	t.epoch += uint64(epochs)
+
+	// Every entry has expired.
+	if epochs > ttlCuckooPrecision {
+		t.filter.Reset()
+		t.swept = t.epoch
+		return
+	}
+
+	if t.epoch-t.swept >= 1<<(ttlCuckooStampBits-1) {
+		t.sweep()
+	}
+}
+
+// compact reclaims expired entries from the next few buckets, so that space
+// is reclaimed gradually as data is added.
+func (t *TTLCuckooFilter) compact() {
+	removed := uint(0)
+	for n := 0; n < ttlCuckooCompaction; n++ {
+		removed += t.compactBucket(t.cursor)
+		t.cursor = (t.cursor + 1) % t.filter.m
+	}
+	if removed > 0 {
+		t.filter.unstash()
+	}
+}
+
+// compactBucket empties the expired entries of the bucket for hash value i.
+// It returns the number of entries reclaimed.
+func (t *TTLCuckooFilter) compactBucket(i uint) uint {
+	removed := uint(0)
+	for j := uint(0); j < t.filter.b; j++ {
+		if t.filter.entry(i, j) != 0 && !t.live(t.filter.value(i, j)) {
+			t.filter.put(i, j, 0, 0)
+			t.filter.count--
+			removed++
+		}
+	}
+	return removed
+}
+
+// sweep reclaims every expired entry in the buckets and the stash. It returns
+// the number of entries reclaimed.
+func (t *TTLCuckooFilter) sweep() uint {
+	removed := uint(0)
+	for idx := 0; idx < len(t.filter.stash); idx++ {
+		if !t.live(t.filter.stash[idx].v) {
+			t.filter.stash = append(t.filter.stash[:idx], t.filter.stash[idx+1:]...)
+			t.filter.count--
+			removed++
+			idx--
+		}
+	}
+	for i := uint(0); i < t.filter.m; i++ {
+		removed += t.compactBucket(i)
+	}
+	if removed > 0 {
+		t.filter.unstash()
+	}
+	t.swept = t.epoch
+	return removed
+}
+
+// SetHash sets the hashing function used in the filter.
+// For the effect on false positive rates see: https://github.com/tylertreat/BoomFilters/pull/1
+func (t *TTLCuckooFilter) SetHash(h hash.Hash32) {
+	t.filter.SetHash(h)
+}
+
+// SetClock sets the function used to get the current time, which defaults to
+// time.Now. The current epoch restarts at the clock's current time, so
+// existing entries keep their age in epochs.
+func (t *TTLCuckooFilter) SetClock(clock func() time.Time) {
+	t.clock = clock
+	t.started = clock()
+}
+
+// SetRandSource sets the source used to pick the entries to relocate when
+// inserting into full buckets, which defaults to the global math/rand source.
+// Filters using the same seeded source end up in identical states for
+// identical input. The state of a source created with NewRandSource is
+// persisted by WriteTo.
+func (t *TTLCuckooFilter) SetRandSource(src rand.Source) {
+	t.filter.SetRandSource(src)
+}
+
+// WriteTo writes a binary representation of the TTLCuckooFilter to an i/o
+// stream. It returns the number of bytes written.
+func (t *TTLCuckooFilter) WriteTo(stream io.Writer) (int64, error) {
+	err := binary.Write(stream, binary.BigEndian, int64(t.ttl))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, int64(t.interval))
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, t.epoch)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, t.started.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, t.swept)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(stream, binary.BigEndian, uint64(t.cursor))
+	if err != nil {
+		return 0, err
+	}
+	num, err := t.filter.WriteTo(stream)
+	if err != nil {
+		return 0, err
+	}
+	return int64(6*binary.Size(uint64(0))) + num, nil
+}
+
+// ReadFrom reads a binary representation of TTLCuckooFilter (such as might
+// have been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (t *TTLCuckooFilter) ReadFrom(stream io.Reader) (int64, error) {
+	var ttl, interval, started int64
+	var epoch, swept, cursor uint64
+	err := binary.Read(stream, binary.BigEndian, &ttl)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &interval)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &epoch)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &started)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &swept)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &cursor)
+	if err != nil {
+		return 0, err
+	}
+	filter := &CuckooFilter{}
+	if t.filter != nil {
+		filter.hash = t.filter.hash
+	}
+	num, err := filter.ReadFrom(stream)
+	if err != nil {
+		return 0, err
+	}
+
+	t.filter = filter
+	t.ttl = time.Duration(ttl)
+	t.interval = time.Duration(interval)
+	t.epoch = epoch
+	t.started = time.Unix(0, started)
+	t.swept = swept
+	t.cursor = uint(cursor)
+	if t.clock == nil {
+		t.clock = time.Now
+	}
+	return int64(6*binary.Size(uint64(0))) + num, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (t *TTLCuckooFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := t.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (t *TTLCuckooFilter) GobDecode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+	_, err := t.ReadFrom(buf)
+
+	return err
+}
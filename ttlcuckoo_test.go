@@ -0,0 +1,307 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/gob"
+	"hash/fnv"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestTTLCuckooFilter creates a TTLCuckooFilter using the given test clock.
+func newTestTTLCuckooFilter(clock *testClock, n uint, ttl time.Duration) *TTLCuckooFilter {
+	f := NewTTLCuckooFilter(n, ttl, 0.001)
+	f.SetClock(clock.Now)
+	return f
+}
+
+// Ensures that entries are members until their time-to-live elapses.
+func TestTTLCuckooExpiry(t *testing.T) {
+	clock := newTestClock()
+	f := newTestTTLCuckooFilter(clock, 100, time.Minute)
+
+	if ttl := f.TTL(); ttl != time.Minute {
+		t.Errorf("Expected 1m, got %s", ttl)
+	}
+
+	f.Add([]byte(`a`))
+	clock.Advance(30 * time.Second)
+	f.Add([]byte(`b`))
+
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	clock.Advance(31 * time.Second)
+
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member until an epoch past its time-to-live")
+	}
+
+	clock.Advance(5 * time.Second)
+
+	if f.Test([]byte(`a`)) {
+		t.Error("`a` should have expired")
+	}
+
+	if !f.Test([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+
+	clock.Advance(30 * time.Second)
+
+	if f.Test([]byte(`b`)) {
+		t.Error("`b` should have expired")
+	}
+
+	if f.Test([]byte(`c`)) {
+		t.Error("`c` should not be a member")
+	}
+}
+
+// Ensures that adding a member restarts its time-to-live.
+func TestTTLCuckooRefresh(t *testing.T) {
+	clock := newTestClock()
+	f := newTestTTLCuckooFilter(clock, 100, time.Minute)
+
+	if member, _ := f.TestAndAdd([]byte(`a`)); member {
+		t.Error("`a` should not be a member")
+	}
+
+	clock.Advance(50 * time.Second)
+
+	if member, _ := f.TestAndAdd([]byte(`a`)); !member {
+		t.Error("`a` should be a member")
+	}
+
+	clock.Advance(50 * time.Second)
+
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if count := f.Count(); count != 1 {
+		t.Errorf("Expected 1, got %d", count)
+	}
+
+	if !f.TestAndRemove([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if f.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+
+	f.Add([]byte(`b`))
+	clock.Advance(2 * time.Minute)
+
+	if f.TestAndRemove([]byte(`b`)) {
+		t.Error("`b` should have expired")
+	}
+}
+
+// Ensures that Sweep reclaims expired entries and leaves live ones.
+func TestTTLCuckooSweep(t *testing.T) {
+	clock := newTestClock()
+	f := newTestTTLCuckooFilter(clock, 1000, time.Minute)
+
+	for i := 0; i < 500; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	clock.Advance(45 * time.Second)
+
+	for i := 500; i < 600; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if swept := f.Sweep(); swept != 0 {
+		t.Errorf("Expected 0, got %d", swept)
+	}
+
+	clock.Advance(30 * time.Second)
+
+	// Insertions compact a couple of buckets each, so some entries may
+	// already be reclaimed.
+	f.Add([]byte(`a`))
+	swept := f.Sweep()
+	if swept == 0 || swept > 500 {
+		t.Errorf("Expected up to 500, got %d", swept)
+	}
+
+	if count := f.Count(); count != 101 {
+		t.Errorf("Expected 101, got %d", count)
+	}
+
+	for i := 500; i < 600; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+
+	if f.Reset() != f {
+		t.Error("Returned TTLCuckooFilter should be the same instance")
+	}
+
+	if count := f.Count(); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+}
+
+// Ensures that a full filter reclaims expired entries to make room.
+func TestTTLCuckooFull(t *testing.T) {
+	clock := newTestClock()
+	f := newTestTTLCuckooFilter(clock, 100, time.Minute)
+	f.SetRandSource(NewRandSource(42))
+
+	n := 0
+	for ; f.Add([]byte(strconv.Itoa(n))) == nil; n++ {
+	}
+
+	clock.Advance(65 * time.Second)
+	for i := 0; i < 10; i++ {
+		if err := f.Add([]byte(`new` + strconv.Itoa(i))); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+
+	if count := f.Count(); count != 10 {
+		t.Errorf("Expected 10, got %d", count)
+	}
+
+	for i := 0; i < n; i++ {
+		if f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to have expired", i)
+		}
+	}
+}
+
+// Ensures that stamps which wrap around don't make expired entries live again.
+func TestTTLCuckooWrapAround(t *testing.T) {
+	clock := newTestClock()
+	f := newTestTTLCuckooFilter(clock, 100, 16*time.Second)
+	f.Add([]byte(`a`))
+
+	// Keep the filter busy so epochs advance one at a time.
+	for i := 0; i < 256; i++ {
+		clock.Advance(time.Second)
+		f.Test([]byte(`b`))
+	}
+
+	if f.Test([]byte(`a`)) {
+		t.Error("`a` should have expired")
+	}
+
+	if count := f.Count(); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+}
+
+// Ensures that the filter can be serialized and resumed.
+func TestTTLCuckooSerialization(t *testing.T) {
+	clock := newTestClock()
+	f := newTestTTLCuckooFilter(clock, 100, time.Minute)
+	f.Add([]byte(`a`))
+	clock.Advance(45 * time.Second)
+	f.Add([]byte(`b`))
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(f); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &TTLCuckooFilter{}
+	if err := gob.NewDecoder(&buf).Decode(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	wn, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := NewTTLCuckooFilter(10, time.Hour, 0.1)
+	rn, err := read.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wn != rn {
+		t.Errorf("Expected %d bytes read, got %d", wn, rn)
+	}
+
+	for _, restored := range []*TTLCuckooFilter{decoded, read} {
+		restored.SetClock(clock.Now)
+		clock.Advance(20 * time.Second)
+
+		if restored.TTL() != time.Minute {
+			t.Errorf("Expected 1m, got %s", restored.TTL())
+		}
+
+		if restored.Test([]byte(`a`)) {
+			t.Error("`a` should have expired")
+		}
+
+		if !restored.Test([]byte(`b`)) {
+			t.Error("`b` should be a member")
+		}
+	}
+}
+
+// Ensures that a filter with a custom hash can be resumed by a filter using the
+// same hash.
+func TestTTLCuckooSerializationCustomHash(t *testing.T) {
+	clock := newTestClock()
+	f := newTestTTLCuckooFilter(clock, 1000, time.Minute)
+	f.SetHash(fnv.New32a())
+	for i := 0; i < 100; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	read := NewTTLCuckooFilter(10, time.Hour, 0.1)
+	read.SetHash(fnv.New32a())
+	if _, err := read.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read.SetClock(clock.Now)
+
+	for i := 0; i < 100; i++ {
+		if !read.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+}
+
+func BenchmarkTTLCuckooAdd(b *testing.B) {
+	b.StopTimer()
+	f := NewTTLCuckooFilter(uint(b.N), time.Minute, 0.001)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
+
+func BenchmarkTTLCuckooTest(b *testing.B) {
+	b.StopTimer()
+	f := NewTTLCuckooFilter(uint(b.N), time.Minute, 0.001)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Test(data[n])
+	}
+}